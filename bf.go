@@ -30,14 +30,46 @@ func New(m, k int, h Hasher, s Store) *BF {
 }
 
 func (bf *BF) indexes(ctx context.Context, d []byte) ([]int, error) {
-	indexes := make([]int, bf.k)
-	for i := 0; i < bf.k; i++ {
-		x, err := bf.h.Hash(ctx, i, d)
+	return hashIndexes(ctx, bf.h, bf.m, bf.k, d)
+}
+
+func (bf *BF) indexesAll(ctx context.Context, dd [][]byte) ([][]int, error) {
+	all := make([][]int, len(dd))
+	for i, d := range dd {
+		indexes, err := bf.indexes(ctx, d)
+		if err != nil {
+			return nil, fmt.Errorf("failed at #%d: %w", i, err)
+		}
+		all[i] = indexes
+	}
+	return all, nil
+}
+
+// hashIndexes computes k indexes of a byte array with a hasher.
+func hashIndexes(ctx context.Context, h Hasher, m, k int, d []byte) ([]int, error) {
+	if ih, ok := h.(IndexesHasher); ok {
+		indexes, err := ih.Indexes(ctx, d)
+		if err != nil {
+			return nil, fmt.Errorf("hash failed: %w", err)
+		}
+		if len(indexes) != k {
+			return nil, fmt.Errorf("hasher returns wrong number of indexes: got=%d want=%d", len(indexes), k)
+		}
+		for i, x := range indexes {
+			if x < 0 || x >= m {
+				return nil, fmt.Errorf("hasher out of range: k=%d got=%d want=0~%d", i, x, m)
+			}
+		}
+		return indexes, nil
+	}
+	indexes := make([]int, k)
+	for i := 0; i < k; i++ {
+		x, err := h.Hash(ctx, i, d)
 		if err != nil {
 			return nil, fmt.Errorf("hash failed for k=%d: %w", i, err)
 		}
-		if x < 0 || x >= bf.m {
-			return nil, fmt.Errorf("hasher out of range: k=%d got=%d want=0~%d", i, x, bf.m)
+		if x < 0 || x >= m {
+			return nil, fmt.Errorf("hasher out of range: k=%d got=%d want=0~%d", i, x, m)
 		}
 		indexes[i] = x
 	}
@@ -79,3 +111,91 @@ func (bf *BF) Check(ctx context.Context, d []byte) (bool, error) {
 func (bf *BF) CheckString(ctx context.Context, s string) (bool, error) {
 	return bf.Check(ctx, []byte(s))
 }
+
+// CheckAndPut checks that a byte array is in the filter, and puts it.
+// It returns true when the byte array was in the filter before.
+// When the store is a CheckAndSetStore, it is done by a call atomically,
+// otherwise it checks and sets bits by two calls.
+func (bf *BF) CheckAndPut(ctx context.Context, d []byte) (bool, error) {
+	indexes, err := bf.indexes(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	if cs, ok := bf.s.(CheckAndSetStore); ok {
+		r, err := cs.CheckAndSetBits(ctx, indexes...)
+		if err != nil {
+			return false, fmt.Errorf("store CheckAndSetBits failed: indexes=%+v: %w", indexes, err)
+		}
+		return r, nil
+	}
+	r, err := bf.s.CheckBits(ctx, indexes...)
+	if err != nil {
+		return false, fmt.Errorf("store CheckBits failed: indexes=%+v: %w", indexes, err)
+	}
+	if r {
+		return true, nil
+	}
+	err = bf.s.SetBits(ctx, indexes...)
+	if err != nil {
+		return false, fmt.Errorf("store SetBits failed: indexes=%+v: %w", indexes, err)
+	}
+	return false, nil
+}
+
+// PutAll puts byte arrays to the filter.
+// When the store is a BatchStore, all bits are set by a call.
+func (bf *BF) PutAll(ctx context.Context, dd [][]byte) error {
+	if len(dd) == 0 {
+		return nil
+	}
+	all, err := bf.indexesAll(ctx, dd)
+	if err != nil {
+		return err
+	}
+	if bs, ok := bf.s.(BatchStore); ok {
+		err := bs.SetBitsAll(ctx, all)
+		if err != nil {
+			return fmt.Errorf("store SetBitsAll failed: %w", err)
+		}
+		return nil
+	}
+	for i, indexes := range all {
+		err := bf.s.SetBits(ctx, indexes...)
+		if err != nil {
+			return fmt.Errorf("store SetBits failed at #%d: indexes=%+v: %w", i, indexes, err)
+		}
+	}
+	return nil
+}
+
+// CheckAll checks that byte arrays are in the filter.
+// It returns results in the order of dd.
+// When the store is a BatchStore, all bits are checked by a call.
+func (bf *BF) CheckAll(ctx context.Context, dd [][]byte) ([]bool, error) {
+	if len(dd) == 0 {
+		return nil, nil
+	}
+	all, err := bf.indexesAll(ctx, dd)
+	if err != nil {
+		return nil, err
+	}
+	if bs, ok := bf.s.(BatchStore); ok {
+		rr, err := bs.CheckBitsAll(ctx, all)
+		if err != nil {
+			return nil, fmt.Errorf("store CheckBitsAll failed: %w", err)
+		}
+		if len(rr) != len(dd) {
+			return nil, fmt.Errorf("store CheckBitsAll returns unexpected number of results: want=%d got=%d", len(dd), len(rr))
+		}
+		return rr, nil
+	}
+	rr := make([]bool, len(all))
+	for i, indexes := range all {
+		r, err := bf.s.CheckBits(ctx, indexes...)
+		if err != nil {
+			return nil, fmt.Errorf("store CheckBits failed at #%d: indexes=%+v: %w", i, indexes, err)
+		}
+		rr[i] = r
+	}
+	return rr, nil
+}
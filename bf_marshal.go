@@ -0,0 +1,113 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+func (bf *BF) marshalHeader() (marshalHeader, error) {
+	ih, ok := bf.h.(IdentifiableHasher)
+	if !ok {
+		return marshalHeader{}, fmt.Errorf("hasher doesn't support identity: %T", bf.h)
+	}
+	return marshalHeader{
+		kind:   marshalKindBF,
+		m:      uint64(bf.m),
+		k:      uint64(bf.k),
+		hasher: ih.Identity(),
+	}, nil
+}
+
+func (bf *BF) memoryStore() (MemoryStore, error) {
+	ms, ok := bf.s.(MemoryStore)
+	if !ok {
+		return nil, fmt.Errorf("store doesn't support serialization: %T", bf.s)
+	}
+	return ms, nil
+}
+
+// WriteTo writes the filter to w in binary form.
+// It works only with IdentifiableHasher and MemoryStore.
+func (bf *BF) WriteTo(w io.Writer) (int64, error) {
+	h, err := bf.marshalHeader()
+	if err != nil {
+		return 0, err
+	}
+	ms, err := bf.memoryStore()
+	if err != nil {
+		return 0, err
+	}
+	bw := newBinaryWriter(w)
+	bw.header(h)
+	bw.bytes(ms)
+	return bw.finish()
+}
+
+// ReadFrom reads the filter from r, which was written by WriteTo.
+// It fails when parameters (m, k) or identity of the hasher are not matched
+// with ones of the filter.
+func (bf *BF) ReadFrom(r io.Reader) (int64, error) {
+	n, data, err := bf.readFrom(r)
+	if err != nil {
+		return n, err
+	}
+	copy(bf.s.(MemoryStore), data)
+	return n, nil
+}
+
+// readFrom reads and verifies the filter from r, and returns its data.
+func (bf *BF) readFrom(r io.Reader) (int64, []byte, error) {
+	want, err := bf.marshalHeader()
+	if err != nil {
+		return 0, nil, err
+	}
+	ms, err := bf.memoryStore()
+	if err != nil {
+		return 0, nil, err
+	}
+	br := newBinaryReader(r)
+	h := br.header()
+	if br.err != nil {
+		return br.n, nil, br.err
+	}
+	err = h.verify(want)
+	if err != nil {
+		return br.n, nil, err
+	}
+	data := make([]byte, len(ms))
+	br.bytesInto(data)
+	n, err := br.finish()
+	if err != nil {
+		return n, nil, err
+	}
+	return n, data, nil
+}
+
+// MarshalBinary encodes the filter into binary form.
+// It works only with IdentifiableHasher and MemoryStore.
+func (bf *BF) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := bf.WriteTo(&b)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the filter from binary form, which was encoded by
+// MarshalBinary.
+// It fails when parameters (m, k) or identity of the hasher are not matched
+// with ones of the filter.
+func (bf *BF) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	_, d, err := bf.readFrom(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("extra %d bytes after the filter", r.Len())
+	}
+	copy(bf.s.(MemoryStore), d)
+	return nil
+}
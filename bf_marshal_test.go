@@ -0,0 +1,138 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+)
+
+func newTestBF(tb testing.TB, m, k, n int, opts ...Option) *BF {
+	tb.Helper()
+	bf := New(m, k, NewHasher(k, m, opts...), nil)
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		err := bf.PutString(ctx, strconv.Itoa(i))
+		if err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return bf
+}
+
+func TestBFMarshalBinary(t *testing.T) {
+	bf := newTestBF(t, 1000, 7, 100)
+	b, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	bf2 := New(1000, 7, nil, nil)
+	err = bf2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !bytes.Equal(bf.s.(MemoryStore), bf2.s.(MemoryStore)) {
+		t.Fatal("store mismatch after unmarshal")
+	}
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		has, err := bf2.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("false negative after unmarshal: %d", i)
+		}
+	}
+}
+
+func TestBFWriteToReadFrom(t *testing.T) {
+	bf := newTestBF(t, 1000, 7, 100, WithSeed(123))
+	var b bytes.Buffer
+	nw, err := bf.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	if int(nw) != b.Len() {
+		t.Errorf("WriteTo returns wrong size: want=%d got=%d", b.Len(), nw)
+	}
+	bf2 := New(1000, 7, NewHasher(7, 1000, WithSeed(123)), nil)
+	nr, err := bf2.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %s", err)
+	}
+	if nr != nw {
+		t.Errorf("ReadFrom returns wrong size: want=%d got=%d", nw, nr)
+	}
+	if !bytes.Equal(bf.s.(MemoryStore), bf2.s.(MemoryStore)) {
+		t.Fatal("store mismatch after ReadFrom")
+	}
+}
+
+func TestBFUnmarshalMismatch(t *testing.T) {
+	b, err := newTestBF(t, 1000, 7, 100).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	for i, bf := range []*BF{
+		New(1001, 7, nil, nil),
+		New(1000, 6, nil, nil),
+		New(1000, 7, NewHasher(7, 1000, WithSeed(1)), nil),
+		New(1000, 7, NewHasher(7, 1000, WithHash(XXHash{})), nil),
+		New(1000, 7, NewHasher(7, 1000, WithDoubleHashing()), nil),
+	} {
+		err := bf.UnmarshalBinary(b)
+		if err == nil {
+			t.Errorf("unmarshal should fail with mismatched filter #%d", i)
+		}
+	}
+
+	bf := New(1000, 7, nil, nil)
+	for _, x := range []int{0, 6, len(b) / 2, len(b) - 1} {
+		broken := append([]byte(nil), b...)
+		broken[x] ^= 0x01
+		err := bf.UnmarshalBinary(broken)
+		if err == nil {
+			t.Errorf("unmarshal should fail with broken data at %d", x)
+		}
+	}
+	if err := bf.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Error("unmarshal should fail with truncated data")
+	}
+	if err := bf.UnmarshalBinary(append(b, 0)); err == nil {
+		t.Error("unmarshal should fail with extra data")
+	}
+	for _, v := range bf.s.(MemoryStore) {
+		if v != 0 {
+			t.Fatal("store is modified by failed unmarshal")
+		}
+	}
+}
+
+func TestBFMarshalDoubleHashing(t *testing.T) {
+	bf := newTestBF(t, 1000, 7, 100, WithDoubleHashing())
+	b, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	bf2 := New(1000, 7, NewHasher(7, 1000, WithDoubleHashing()), nil)
+	err = bf2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		ok, err := bf2.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+	err = New(1000, 7, nil, nil).UnmarshalBinary(b)
+	if err == nil {
+		t.Error("unmarshal without double hashing should fail")
+	}
+}
@@ -58,3 +58,124 @@ func TestBF_Basic(t *testing.T) {
 	checkBlooFilter(t, 1000, 7, 700, 0.1)
 	checkBlooFilter(t, 1000, 7, 1000, 0.1)
 }
+
+// batchStore is a BatchStore for tests, which counts calls.
+type batchStore struct {
+	MemoryStore
+	setCalls   int
+	checkCalls int
+}
+
+func (bs *batchStore) SetBitsAll(ctx context.Context, indexes [][]int) error {
+	bs.setCalls++
+	for _, x := range indexes {
+		bs.MemoryStore.SetBits(ctx, x...)
+	}
+	return nil
+}
+
+func (bs *batchStore) CheckBitsAll(ctx context.Context, indexes [][]int) ([]bool, error) {
+	bs.checkCalls++
+	rr := make([]bool, len(indexes))
+	for i, x := range indexes {
+		rr[i], _ = bs.MemoryStore.CheckBits(ctx, x...)
+	}
+	return rr, nil
+}
+
+func checkBFAll(t *testing.T, bf *BF) {
+	t.Helper()
+	ctx := context.Background()
+	var put, all [][]byte
+	for i := 0; i < 200; i++ {
+		d := []byte(strconv.Itoa(i))
+		if i%2 == 0 {
+			put = append(put, d)
+		}
+		all = append(all, d)
+	}
+	err := bf.PutAll(ctx, put)
+	if err != nil {
+		t.Fatalf("PutAll failed: %s", err)
+	}
+	rr, err := bf.CheckAll(ctx, all)
+	if err != nil {
+		t.Fatalf("CheckAll failed: %s", err)
+	}
+	if len(rr) != len(all) {
+		t.Fatalf("unexpected number of results: want=%d got=%d", len(all), len(rr))
+	}
+	falsePositive := 0
+	for i, r := range rr {
+		want, err := bf.Check(ctx, all[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r != want {
+			t.Errorf("mismatch with Check #%d: want=%t got=%t", i, want, r)
+		}
+		if i%2 == 0 && !r {
+			t.Errorf("false negative: %d", i)
+		}
+		if i%2 == 1 && r {
+			falsePositive++
+		}
+	}
+	if falsePositive > 2 {
+		t.Errorf("too many false positives: %d", falsePositive)
+	}
+}
+
+func TestBFPutAllCheckAll(t *testing.T) {
+	checkBFAll(t, New(2000, 7, nil, nil))
+
+	bs := &batchStore{MemoryStore: NewMemoryStore(2000)}
+	checkBFAll(t, New(2000, 7, nil, bs))
+	if bs.setCalls != 1 || bs.checkCalls != 1 {
+		t.Errorf("batch store should be called once: set=%d check=%d", bs.setCalls, bs.checkCalls)
+	}
+}
+
+// plainStore hides optional interfaces of a Store.
+type plainStore struct {
+	Store
+}
+
+func checkBFCheckAndPut(t *testing.T, bf *BF) {
+	t.Helper()
+	ctx := context.Background()
+	ref := New(bf.m, bf.k, bf.h, nil)
+	for i := 0; i < 200; i++ {
+		d := []byte(strconv.Itoa(i))
+		want, err := ref.Check(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ref.Put(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := bf.CheckAndPut(ctx, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("unexpected check and put for %d: want=%t got=%t", i, want, got)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		got, err := bf.CheckAndPut(ctx, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+}
+
+func TestBFCheckAndPut(t *testing.T) {
+	checkBFCheckAndPut(t, New(2000, 7, nil, nil))
+	checkBFCheckAndPut(t, New(2000, 7, nil, NewAtomicMemoryStore(2000)))
+	checkBFCheckAndPut(t, New(2000, 7, nil, plainStore{NewMemoryStore(2000)}))
+}
@@ -0,0 +1,174 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestBlockedIndexes(t *testing.T) {
+	ctx := context.Background()
+	for _, m := range []int{100, 512, 1024, 1000000, 1000448} {
+		h := NewHasher(10, m, WithBlocked())
+		ih, ok := h.(IndexesHasher)
+		if !ok {
+			t.Fatalf("blocked hasher should be IndexesHasher")
+		}
+		for i := 0; i < 1000; i++ {
+			d := []byte(strconv.Itoa(i))
+			indexes, err := ih.Indexes(ctx, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			block := indexes[0] / blockBits
+			for j, x := range indexes {
+				if x < 0 || x >= m {
+					t.Fatalf("out of range: m=%d d=%q j=%d x=%d", m, d, j, x)
+				}
+				if x/blockBits != block {
+					t.Fatalf("index out of block: m=%d d=%q j=%d x=%d block=%d", m, d, j, x, block)
+				}
+				got, err := h.Hash(ctx, j, d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != x {
+					t.Fatalf("Hash and Indexes mismatch: m=%d d=%q j=%d want=%d got=%d", m, d, j, x, got)
+				}
+			}
+		}
+	}
+}
+
+func TestBlockedIdentity(t *testing.T) {
+	id := NewHasher(7, 1024, WithBlocked(), WithSeed(3)).(IdentifiableHasher).Identity()
+	want := HasherIdentity{Name: "metro", Seed: 3, Blocked: true}
+	if id != want {
+		t.Errorf("unexpected identity: want=%+v got=%+v", want, id)
+	}
+}
+
+func checkBlockedFalsePositive(t *testing.T, n int, fpRate float64, opts ...Option) float64 {
+	t.Helper()
+	ctx := context.Background()
+	bf, err := NewWithEstimates(n, fpRate, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		err := bf.PutString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fp := 0
+	for i := n; i < n*11; i++ {
+		ok, err := bf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			fp++
+		}
+	}
+	for i := 0; i < n; i++ {
+		ok, err := bf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+	return float64(fp) / float64(n*10)
+}
+
+func TestBlockedFalsePositive(t *testing.T) {
+	for _, tc := range []struct {
+		n      int
+		fpRate float64
+	}{
+		{10000, 0.01},
+		{100000, 0.01},
+		{100000, 0.001},
+	} {
+		t.Run(strconv.Itoa(tc.n)+"_"+strconv.FormatFloat(tc.fpRate, 'g', -1, 64), func(t *testing.T) {
+			std := checkBlockedFalsePositive(t, tc.n, tc.fpRate)
+			blk := checkBlockedFalsePositive(t, tc.n, tc.fpRate, WithBlocked())
+			t.Logf("false positive rate: standard=%f blocked=%f", std, blk)
+			// blocked layout trades a little accuracy for cache efficiency.
+			if blk > tc.fpRate*2 {
+				t.Errorf("too high false positive rate: want<=%f got=%f", tc.fpRate*2, blk)
+			}
+		})
+	}
+}
+
+func TestBlockedMarshal(t *testing.T) {
+	bf, err := NewWithEstimates(1000, 0.01, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.m%blockBits != 0 {
+		t.Errorf("m should be rounded up to blocks: %d", bf.m)
+	}
+	b, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	err = New(bf.m, bf.k, NewHasher(bf.k, bf.m, WithBlocked()), nil).UnmarshalBinary(b)
+	if err != nil {
+		t.Errorf("unmarshal failed: %s", err)
+	}
+	err = New(bf.m, bf.k, nil, nil).UnmarshalBinary(b)
+	if err == nil {
+		t.Error("unmarshal into standard layout should fail")
+	}
+}
+
+func TestBlockedSBF(t *testing.T) {
+	sf, err := NewSBF(1000, 0.01, WithBlocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSBF(t, sf, 5000, 0.01*2)
+	for i, s := range sf.slices {
+		if s.bf.m%blockBits != 0 {
+			t.Errorf("slice #%d: m should be rounded up to blocks: %d", i, s.bf.m)
+		}
+	}
+}
+
+const benchBlockedN = 4000000
+
+func newBenchBF(b *testing.B, opts ...Option) *BF {
+	ctx := context.Background()
+	bf, err := NewWithEstimates(benchBlockedN, 0.01, opts...)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < benchBlockedN; i += 4 {
+		bf.PutString(ctx, strconv.Itoa(i))
+	}
+	return bf
+}
+
+func benchmarkBFCheck(b *testing.B, bf *BF) {
+	ctx := context.Background()
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = []byte(strconv.Itoa(i * 7919))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bf.Check(ctx, keys[i%len(keys)])
+	}
+}
+
+func BenchmarkBFCheck_Standard(b *testing.B) {
+	benchmarkBFCheck(b, newBenchBF(b))
+}
+
+func BenchmarkBFCheck_Blocked(b *testing.B) {
+	benchmarkBFCheck(b, newBenchBF(b, WithBlocked()))
+}
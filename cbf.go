@@ -0,0 +1,204 @@
+package bloomfilter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrNotPresent is returned when deleting an item which is not in the filter.
+var ErrNotPresent = errors.New("item is not present in the filter")
+
+// CounterStore defines counters store for counting bloom filter (CBF).
+type CounterStore interface {
+	// IncrCounters increments counters on indexes.
+	// Counters saturate at their max value.
+	IncrCounters(ctx context.Context, indexes ...int) error
+	// DecrCounters decrements counters on indexes.
+	// Saturated counters are kept as is, because their actual counts are
+	// unknown.
+	// When any counter is zero, it returns ErrNotPresent without modifying
+	// any counters.
+	DecrCounters(ctx context.Context, indexes ...int) error
+	// CheckCounters checks all counters are non-zero on indexes.
+	CheckCounters(ctx context.Context, indexes ...int) (bool, error)
+}
+
+// CBF provides counting bloom filter, which supports deletion.
+type CBF struct {
+	m int
+	k int
+	h Hasher
+	s CounterStore
+}
+
+// NewCBF creates a counting bloom filter.
+// When s is nil, it uses MemoryCounterStore with 4 bits counters.
+func NewCBF(m, k int, h Hasher, s CounterStore) *CBF {
+	if h == nil {
+		h = NewHasher(k, m)
+	}
+	if s == nil {
+		s, _ = NewMemoryCounterStore(m, 4)
+	}
+	return &CBF{
+		m: m,
+		k: k,
+		h: h,
+		s: s,
+	}
+}
+
+// indexes computes unique indexes of a byte array.
+func (cf *CBF) indexes(ctx context.Context, d []byte) ([]int, error) {
+	indexes, err := hashIndexes(ctx, cf.h, cf.m, cf.k, d)
+	if err != nil {
+		return nil, err
+	}
+	// remove duplicated indexes, to count each item once per counter.
+	sort.Ints(indexes)
+	n := 0
+	for i, x := range indexes {
+		if i > 0 && x == indexes[n-1] {
+			continue
+		}
+		indexes[n] = x
+		n++
+	}
+	return indexes[:n], nil
+}
+
+// Put puts a byte array to the filter.
+func (cf *CBF) Put(ctx context.Context, d []byte) error {
+	indexes, err := cf.indexes(ctx, d)
+	if err != nil {
+		return err
+	}
+	err = cf.s.IncrCounters(ctx, indexes...)
+	if err != nil {
+		return fmt.Errorf("store IncrCounters failed: indexes=%+v: %w", indexes, err)
+	}
+	return nil
+}
+
+// PutString puts a string to the filter.
+func (cf *CBF) PutString(ctx context.Context, s string) error {
+	return cf.Put(ctx, []byte(s))
+}
+
+// Delete deletes a byte array from the filter.
+// It returns ErrNotPresent when the byte array is not in the filter.
+func (cf *CBF) Delete(ctx context.Context, d []byte) error {
+	indexes, err := cf.indexes(ctx, d)
+	if err != nil {
+		return err
+	}
+	err = cf.s.DecrCounters(ctx, indexes...)
+	if err != nil {
+		if errors.Is(err, ErrNotPresent) {
+			return err
+		}
+		return fmt.Errorf("store DecrCounters failed: indexes=%+v: %w", indexes, err)
+	}
+	return nil
+}
+
+// DeleteString deletes a string from the filter.
+func (cf *CBF) DeleteString(ctx context.Context, s string) error {
+	return cf.Delete(ctx, []byte(s))
+}
+
+// Check checks that a byte array is in the filter.
+func (cf *CBF) Check(ctx context.Context, d []byte) (bool, error) {
+	indexes, err := cf.indexes(ctx, d)
+	if err != nil {
+		return false, err
+	}
+	r, err := cf.s.CheckCounters(ctx, indexes...)
+	if err != nil {
+		return false, fmt.Errorf("store CheckCounters failed: indexes=%+v: %w", indexes, err)
+	}
+	return r, nil
+}
+
+// CheckString checks that a string is in the filter.
+func (cf *CBF) CheckString(ctx context.Context, s string) (bool, error) {
+	return cf.Check(ctx, []byte(s))
+}
+
+func checkCounterWidth(width int) error {
+	switch width {
+	case 4, 8, 16:
+		return nil
+	default:
+		return fmt.Errorf("unsupported counter width: %d (should be 4, 8 or 16)", width)
+	}
+}
+
+// MemoryCounterStore provides CounterStore interface with memory.
+type MemoryCounterStore struct {
+	width int
+	max   uint16
+	data  registers
+}
+
+// NewMemoryCounterStore creates a memory counter store, which has n counters
+// of width bits. The width should be 4, 8 or 16.
+func NewMemoryCounterStore(n, width int) (*MemoryCounterStore, error) {
+	err := checkCounterWidth(width)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryCounterStore{
+		width: width,
+		max:   uint16((uint32(1) << width) - 1),
+		data:  newRegisters(n, width),
+	}, nil
+}
+
+func (ms *MemoryCounterStore) get(x int) uint16 {
+	return ms.data.get(x, ms.width)
+}
+
+func (ms *MemoryCounterStore) set(x int, v uint16) {
+	ms.data.set(x, ms.width, v)
+}
+
+// IncrCounters increments counters on indexes.
+func (ms *MemoryCounterStore) IncrCounters(_ context.Context, indexes ...int) error {
+	for _, x := range indexes {
+		if v := ms.get(x); v < ms.max {
+			ms.set(x, v+1)
+		}
+	}
+	return nil
+}
+
+// DecrCounters decrements counters on indexes.
+func (ms *MemoryCounterStore) DecrCounters(_ context.Context, indexes ...int) error {
+	for _, x := range indexes {
+		if ms.get(x) == 0 {
+			return ErrNotPresent
+		}
+	}
+	for _, x := range indexes {
+		if v := ms.get(x); v > 0 && v < ms.max {
+			ms.set(x, v-1)
+		}
+	}
+	return nil
+}
+
+// CheckCounters checks all counters are non-zero on indexes.
+func (ms *MemoryCounterStore) CheckCounters(_ context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	for _, x := range indexes {
+		if ms.get(x) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,117 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisCounterStore provides CounterStore interface with Redis.
+type RedisCounterStore struct {
+	c     redis.UniversalClient
+	key   string
+	width int
+	typ   string
+}
+
+// NewRedisCounterStore creates a counter store which stores counters of
+// width bits into a Redis key. The width should be 4, 8 or 16.
+func NewRedisCounterStore(uc redis.UniversalClient, name string, width int) (*RedisCounterStore, error) {
+	err := checkCounterWidth(width)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisCounterStore{
+		c:     uc,
+		key:   name,
+		width: width,
+		typ:   "u" + strconv.Itoa(width),
+	}, nil
+}
+
+// IncrCounters increments counters on indexes.
+func (rs *RedisCounterStore) IncrCounters(ctx context.Context, indexes ...int) error {
+	// using "BITFIELD OVERFLOW SAT INCRBY ... 1", saturate counters at max.
+	args := make([]interface{}, 0, 2+4*len(indexes))
+	args = append(args, "OVERFLOW", "SAT")
+	for _, x := range indexes {
+		args = append(args, "INCRBY", rs.typ, x*rs.width, 1)
+	}
+	_, err := rs.c.BitField(ctx, rs.key, args...).Result()
+	return err
+}
+
+// redisDecrCounters decrements counters atomically.
+// When any counter is zero, it returns 0 without modifying counters.
+var redisDecrCounters = redis.NewScript(`
+local typ, max = ARGV[1], tonumber(ARGV[2])
+local args = {}
+for i = 3, #ARGV do
+  table.insert(args, 'GET')
+  table.insert(args, typ)
+  table.insert(args, ARGV[i])
+end
+local vals = redis.call('BITFIELD', KEYS[1], unpack(args))
+for _, v in ipairs(vals) do
+  if v == 0 then
+    return 0
+  end
+end
+args = {}
+for i, v in ipairs(vals) do
+  if v < max then
+    table.insert(args, 'INCRBY')
+    table.insert(args, typ)
+    table.insert(args, ARGV[i+2])
+    table.insert(args, -1)
+  end
+end
+if #args > 0 then
+  redis.call('BITFIELD', KEYS[1], unpack(args))
+end
+return 1
+`)
+
+// DecrCounters decrements counters on indexes.
+func (rs *RedisCounterStore) DecrCounters(ctx context.Context, indexes ...int) error {
+	args := make([]interface{}, 0, 2+len(indexes))
+	args = append(args, rs.typ, (1<<rs.width)-1)
+	for _, x := range indexes {
+		args = append(args, x*rs.width)
+	}
+	r, err := redisDecrCounters.Run(ctx, rs.c, []string{rs.key}, args...).Int()
+	if err != nil {
+		return err
+	}
+	if r == 0 {
+		return ErrNotPresent
+	}
+	return nil
+}
+
+// CheckCounters checks all counters are non-zero on indexes.
+func (rs *RedisCounterStore) CheckCounters(ctx context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	args := make([]interface{}, 0, 3*len(indexes))
+	for _, x := range indexes {
+		args = append(args, "GET", rs.typ, x*rs.width)
+	}
+	r, err := rs.c.BitField(ctx, rs.key, args...).Result()
+	if err != nil {
+		return false, err
+	}
+	for _, v := range r {
+		if v == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Drop deletes the key of counters from Redis.
+func (rs *RedisCounterStore) Drop(ctx context.Context) error {
+	return rs.c.Del(ctx, rs.key).Err()
+}
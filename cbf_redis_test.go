@@ -0,0 +1,26 @@
+package bloomfilter
+
+import (
+	"testing"
+)
+
+func TestRedisCBFBasic(t *testing.T) {
+	c := newTestRedisClient(t)
+	for _, width := range []int{4, 8, 16} {
+		s, err := NewRedisCounterStore(c, t.Name(), width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkCBF(t, NewCBF(1000, 7, nil, s))
+		c.Del(c.Context(), t.Name())
+	}
+}
+
+func TestRedisCBFSaturate(t *testing.T) {
+	c := newTestRedisClient(t)
+	s, err := NewRedisCounterStore(c, t.Name(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCBFSaturate(t, NewCBF(1000, 7, nil, s))
+}
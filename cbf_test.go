@@ -0,0 +1,142 @@
+package bloomfilter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func checkCBF(t *testing.T, cf *CBF) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		err := cf.PutString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	// delete even numbers.
+	for i := 0; i < 100; i += 2 {
+		err := cf.DeleteString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("delete failed #%d: %s", i, err)
+		}
+	}
+	falsePositive := 0
+	for i := 0; i < 100; i++ {
+		has, err := cf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if i%2 == 1 && !has {
+			t.Errorf("false negative: %d", i)
+		}
+		if i%2 == 0 && has {
+			falsePositive++
+		}
+	}
+	if falsePositive > 1 {
+		t.Errorf("too many false positives after delete: %d", falsePositive)
+	}
+
+	// delete items which are never put.
+	err := cf.DeleteString(ctx, "never put")
+	if !errors.Is(err, ErrNotPresent) {
+		t.Errorf("delete non-present item should fail with ErrNotPresent: %v", err)
+	}
+}
+
+func TestCBFBasic(t *testing.T) {
+	for _, width := range []int{4, 8, 16} {
+		s, err := NewMemoryCounterStore(1000, width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkCBF(t, NewCBF(1000, 7, nil, s))
+	}
+}
+
+func TestCBFDeleteNotPresent(t *testing.T) {
+	cf := NewCBF(1000, 7, nil, nil)
+	ctx := context.Background()
+	err := cf.PutString(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = cf.DeleteString(ctx, "foo")
+	if err != nil {
+		t.Fatalf("delete failed: %s", err)
+	}
+	err = cf.DeleteString(ctx, "foo")
+	if !errors.Is(err, ErrNotPresent) {
+		t.Fatalf("second delete should fail with ErrNotPresent: %v", err)
+	}
+	for _, v := range cf.s.(*MemoryCounterStore).data {
+		if v != 0 {
+			t.Fatal("counters are modified by failed delete")
+		}
+	}
+}
+
+func checkCBFSaturate(t *testing.T, cf *CBF) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		err := cf.PutString(ctx, "foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// saturated counters are never decremented.
+	for i := 0; i < 30; i++ {
+		err := cf.DeleteString(ctx, "foo")
+		if err != nil {
+			t.Fatalf("delete failed #%d: %s", i, err)
+		}
+	}
+	has, err := cf.CheckString(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Error("saturated item should be kept")
+	}
+}
+
+func TestCBFSaturate(t *testing.T) {
+	checkCBFSaturate(t, NewCBF(1000, 7, nil, nil))
+}
+
+func TestMemoryCounterStore(t *testing.T) {
+	ctx := context.Background()
+	for _, width := range []int{4, 8, 16} {
+		ms, err := NewMemoryCounterStore(10, width)
+		if err != nil {
+			t.Fatal(err)
+		}
+		max := int(ms.max)
+		for i := 0; i < max+1; i++ {
+			ms.IncrCounters(ctx, 3)
+		}
+		ms.IncrCounters(ctx, 2, 4)
+		for x, want := range []uint16{0, 0, 1, ms.max, 1, 0} {
+			if got := ms.get(x); got != want {
+				t.Errorf("unexpected counter width=%d x=%d: want=%d got=%d", width, x, want, got)
+			}
+		}
+		if err := ms.DecrCounters(ctx, 2, 3, 4); err != nil {
+			t.Fatalf("decrement failed: %s", err)
+		}
+		for x, want := range []uint16{0, 0, 0, ms.max, 0, 0} {
+			if got := ms.get(x); got != want {
+				t.Errorf("unexpected counter after decrement width=%d x=%d: want=%d got=%d", width, x, want, got)
+			}
+		}
+	}
+	for _, width := range []int{0, 1, 2, 3, 5, 32} {
+		if _, err := NewMemoryCounterStore(10, width); err == nil {
+			t.Errorf("should fail with width=%d", width)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Command vbf3migrate copies a filter of bloomfilter.VBF3Redis to the layout
+// of vbf3redis, and verifies it.
+//
+//	vbf3migrate -url redis://127.0.0.1:6379/0 -from old -to new -m 1000000 -k 7
+//
+// It can run while processes update both filters with vbf3redis.DualWriter.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/koron-go/bloomfilter"
+	"github.com/koron-go/bloomfilter/vbf3redis"
+)
+
+func main() {
+	var (
+		url           string
+		from          string
+		to            string
+		m             uint64
+		k             uint
+		samples       int
+		hash          string
+		seed          uint64
+		doubleHashing bool
+		hashTag       bool
+	)
+	flag.StringVar(&url, "url", "redis://127.0.0.1:6379/0", "URL of Redis")
+	flag.StringVar(&from, "from", "", "name of the old filter (bloomfilter.VBF3Redis)")
+	flag.StringVar(&to, "to", "", "name of the new filter (vbf3redis)")
+	flag.Uint64Var(&m, "m", 0, "number of registers of the filter")
+	flag.UintVar(&k, "k", 0, "number of hash functions of the filter")
+	flag.IntVar(&samples, "samples", 10000, "number of registers to verify")
+	flag.StringVar(&hash, "hash", "metro", "name of the hash algorithm")
+	flag.Uint64Var(&seed, "seed", 0, "base of seeds for hash functions, same as the old filter (not verified when the old filter doesn't record it)")
+	flag.BoolVar(&doubleHashing, "double-hashing", false, "the filter uses double hashing")
+	flag.BoolVar(&hashTag, "hash-tag", false, "use key layout for Redis Cluster for the new filter")
+	flag.Parse()
+	if from == "" || to == "" || m == 0 || k == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := []vbf3redis.Option{vbf3redis.WithSeed(seed)}
+	h := bloomfilter.HashByName(hash)
+	if h == nil {
+		log.Fatalf("unknown hash: %s", hash)
+	}
+	opts = append(opts, vbf3redis.WithHash(h))
+	if doubleHashing {
+		opts = append(opts, vbf3redis.WithDoubleHashing())
+	}
+	if hashTag {
+		opts = append(opts, vbf3redis.WithHashTag())
+	}
+
+	err := run(url, from, to, m, k, samples, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(url, from, to string, m uint64, k uint, samples int, opts []vbf3redis.Option) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+	ropts, err := redis.ParseURL(url)
+	if err != nil {
+		return err
+	}
+	c := redis.NewClient(ropts)
+	defer c.Close()
+
+	log.Printf("migrating %q to %q", from, to)
+	rf, err := vbf3redis.Migrate(ctx, c, from, to, m, k, opts...)
+	if err != nil {
+		return err
+	}
+	log.Printf("verifying %d samples", samples)
+	err = rf.Verify(ctx, from, samples)
+	if err != nil {
+		return err
+	}
+	log.Print("done")
+	return nil
+}
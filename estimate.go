@@ -0,0 +1,99 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+)
+
+const maxInt = int(^uint(0) >> 1)
+
+func checkEstimateArgs(n int, fpRate float64) error {
+	if n <= 0 {
+		return fmt.Errorf("number of items should be positive: n=%d", n)
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return fmt.Errorf("false positive rate should be in (0, 1): fpRate=%g", fpRate)
+	}
+	return nil
+}
+
+// OptimalM returns the optimal number of bits (m) of a filter which holds n
+// items with false positive rate fpRate.
+func OptimalM(n int, fpRate float64) (int, error) {
+	err := checkEstimateArgs(n, fpRate)
+	if err != nil {
+		return 0, err
+	}
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	if m >= float64(maxInt) {
+		return 0, fmt.Errorf("too large m for n=%d fpRate=%g", n, fpRate)
+	}
+	return int(m), nil
+}
+
+// OptimalK returns the optimal number of hash functions (k) of a filter which
+// has m bits and holds n items.
+func OptimalK(m, n int) (int, error) {
+	if m <= 0 {
+		return 0, fmt.Errorf("number of bits should be positive: m=%d", m)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("number of items should be positive: n=%d", n)
+	}
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return k, nil
+}
+
+// FalsePositiveRate returns the expected false positive rate of a filter which
+// has m bits and k hash functions, and holds n items.
+func FalsePositiveRate(m, k, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	if m <= 0 || k <= 0 {
+		return 1
+	}
+	return math.Pow(1-math.Exp(-float64(k)*float64(n)/float64(m)), float64(k))
+}
+
+// EstimateParameters returns the optimal m and k for n items with false
+// positive rate fpRate.
+// The results can be used for New, NewVBF2, NewVBF3 and vbf3redis.Open.
+func EstimateParameters(n int, fpRate float64) (m, k int, err error) {
+	m, err = OptimalM(n, fpRate)
+	if err != nil {
+		return 0, 0, err
+	}
+	k, err = OptimalK(m, n)
+	if err != nil {
+		return 0, 0, err
+	}
+	return m, k, nil
+}
+
+// NewWithEstimates creates a bloom filter which holds n items with false
+// positive rate fpRate.
+// With WithBlocked, m is rounded up to a multiple of the block size.
+func NewWithEstimates(n int, fpRate float64, opts ...Option) (*BF, error) {
+	m, k, err := EstimateParameters(n, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	if o.blocked {
+		m, err = blockedM(m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ms, ok := o.store.(MemoryStore); ok && len(ms)*8 < m {
+		return nil, fmt.Errorf("too small MemoryStore: want=%d bits got=%d bits", m, len(ms)*8)
+	}
+	if o.hasher == nil {
+		o.hasher = NewHasher(k, m, opts...)
+	}
+	return New(m, k, o.hasher, o.store), nil
+}
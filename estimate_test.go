@@ -0,0 +1,92 @@
+package bloomfilter
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEstimateParameters(t *testing.T) {
+	for _, c := range []struct {
+		n    int
+		p    float64
+		m, k int
+	}{
+		{1000, 0.01, 9586, 7},
+		{1000, 0.001, 14378, 10},
+		{10000, 0.1, 47926, 3},
+		{1000000, 0.01, 9585059, 7},
+	} {
+		m, k, err := EstimateParameters(c.n, c.p)
+		if err != nil {
+			t.Fatalf("failed n=%d p=%g: %s", c.n, c.p, err)
+		}
+		if m != c.m || k != c.k {
+			t.Errorf("unexpected n=%d p=%g: want=(%d,%d) got=(%d,%d)", c.n, c.p, c.m, c.k, m, k)
+		}
+		if fp := FalsePositiveRate(m, k, c.n); math.Abs(fp-c.p)/c.p > 0.1 {
+			t.Errorf("unexpected false positive rate n=%d p=%g: got=%g", c.n, c.p, fp)
+		}
+	}
+}
+
+func TestEstimateParametersInvalid(t *testing.T) {
+	for _, c := range []struct {
+		n int
+		p float64
+	}{
+		{0, 0.01},
+		{-1, 0.01},
+		{1000, 0},
+		{1000, 1},
+		{1000, -0.5},
+		{1000, math.NaN()},
+		{maxInt, 1e-300},
+	} {
+		_, _, err := EstimateParameters(c.n, c.p)
+		if err == nil {
+			t.Errorf("should fail: n=%d p=%g", c.n, c.p)
+		}
+	}
+	if _, err := OptimalK(0, 10); err == nil {
+		t.Errorf("OptimalK should fail with m=0")
+	}
+	if _, err := OptimalK(10, 0); err == nil {
+		t.Errorf("OptimalK should fail with n=0")
+	}
+}
+
+func TestNewWithEstimates(t *testing.T) {
+	const n = 1000
+	bf, err := NewWithEstimates(n, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		err := bf.PutString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	falsePositive := 0
+	for i := n; i < n*11; i++ {
+		has, err := bf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if has {
+			falsePositive++
+		}
+	}
+	errRate := float64(falsePositive) / float64(n*10) * 100
+	if errRate > 2 {
+		t.Errorf("too big error rate: %.2f%% false_positive=%d", errRate, falsePositive)
+	}
+
+	_, err = NewWithEstimates(n, 0.01, WithStore(NewMemoryStore(100)))
+	if err == nil {
+		t.Errorf("should fail with too small MemoryStore")
+	}
+}
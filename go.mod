@@ -3,6 +3,9 @@ module github.com/koron-go/bloomfilter
 go 1.14
 
 require (
+	github.com/cespare/xxhash/v2 v2.1.2
+	github.com/dchest/siphash v1.2.3
 	github.com/dgryski/go-metro v0.0.0-20200812162917-85c65e2d0165
 	github.com/go-redis/redis/v8 v8.11.5
+	github.com/spaolacci/murmur3 v1.1.0
 )
@@ -2,8 +2,13 @@ package bloomfilter
 
 import (
 	"context"
+	"encoding/binary"
+	"fmt"
 
+	"github.com/cespare/xxhash/v2"
+	"github.com/dchest/siphash"
 	"github.com/dgryski/go-metro"
+	"github.com/spaolacci/murmur3"
 )
 
 // Hasher defines hashing method for bloom filter.
@@ -12,18 +17,272 @@ type Hasher interface {
 	Hash(ctx context.Context, k int, d []byte) (int, error)
 }
 
-type metroHash struct {
-	k int
-	m int
+// HasherIdentity describes a Hasher. It is used to verify that persisted
+// filters are loaded with compatible Hasher.
+type HasherIdentity struct {
+	// Name is name of hash algorithm.
+	Name string
+	// Seed is base of seeds for hash functions.
+	Seed uint64
+	// DoubleHashing is true when indexes are derived by double hashing.
+	DoubleHashing bool
+	// Blocked is true when indexes of an item fall in one block.
+	Blocked bool
+}
+
+// IndexesHasher is an optional interface for Hasher, which computes all
+// indexes of data at once. BF uses it when available instead of Hash.
+type IndexesHasher interface {
+	Hasher
+	// Indexes computes k indexes of d.
+	Indexes(ctx context.Context, d []byte) ([]int, error)
+}
+
+// IdentifiableHasher is a Hasher which can describe its identity.
+// BF can be persisted only with IdentifiableHasher.
+type IdentifiableHasher interface {
+	Hasher
+	Identity() HasherIdentity
+}
+
+// Hash64 is a family of 64-bit hash functions, which are selected by seed.
+// All filters compute indexes with Hash64, and MetroHash is used by default.
+type Hash64 interface {
+	// Name returns name of the hash algorithm.
+	// It is recorded with persisted filters, to detect mismatch of hashes.
+	Name() string
+	// Sum64 computes a 64-bit hash of d with seed.
+	Sum64(d []byte, seed uint64) uint64
+}
+
+// Hash128 is an optional interface for Hash64, which computes a 128-bit hash
+// at once. Double hashing uses it when available, otherwise it calls Sum64
+// twice.
+type Hash128 interface {
+	Sum128(d []byte, seed uint64) (uint64, uint64)
+}
+
+// MetroHash is Hash64 with MetroHash. This is the default.
+type MetroHash struct{}
+
+// Name returns "metro".
+func (MetroHash) Name() string { return "metro" }
+
+// Sum64 computes a 64-bit hash of d with seed.
+func (MetroHash) Sum64(d []byte, seed uint64) uint64 {
+	return metro.Hash64(d, seed)
+}
+
+// Sum128 computes a 128-bit hash of d with seed.
+func (MetroHash) Sum128(d []byte, seed uint64) (uint64, uint64) {
+	return metro.Hash128(d, seed)
+}
+
+// XXHash is Hash64 with xxHash (XXH64). A seed is prepended to data.
+type XXHash struct{}
+
+// Name returns "xxhash".
+func (XXHash) Name() string { return "xxhash" }
+
+// Sum64 computes a 64-bit hash of d with seed.
+func (XXHash) Sum64(d []byte, seed uint64) uint64 {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], seed)
+	var x xxhash.Digest
+	x.Reset()
+	x.Write(b[:])
+	x.Write(d)
+	return x.Sum64()
+}
+
+// Murmur3 is Hash64 with MurmurHash3 (x64, 128-bit, lower 64 bits).
+type Murmur3 struct{}
+
+// Name returns "murmur3".
+func (Murmur3) Name() string { return "murmur3" }
+
+// Sum64 computes a 64-bit hash of d with seed.
+// Upper and lower 32 bits of seed are folded to a 32-bit seed.
+func (Murmur3) Sum64(d []byte, seed uint64) uint64 {
+	return murmur3.Sum64WithSeed(d, uint32(seed)^uint32(seed>>32))
+}
+
+// Sum128 computes a 128-bit hash of d with seed.
+func (Murmur3) Sum128(d []byte, seed uint64) (uint64, uint64) {
+	return murmur3.Sum128WithSeed(d, uint32(seed)^uint32(seed>>32))
+}
+
+// FNV is Hash64 with FNV-1a (64-bit). A seed is prepended to data.
+type FNV struct{}
+
+// Name returns "fnv1a".
+func (FNV) Name() string { return "fnv1a" }
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// Sum64 computes a 64-bit hash of d with seed.
+func (FNV) Sum64(d []byte, seed uint64) uint64 {
+	h := uint64(fnvOffset64)
+	for i := 0; i < 8; i++ {
+		h ^= seed & 0xff
+		h *= fnvPrime64
+		seed >>= 8
+	}
+	for _, c := range d {
+		h ^= uint64(c)
+		h *= fnvPrime64
+	}
+	return h
+}
+
+// SipHash is Hash64 with SipHash-2-4, keyed by K0 and K1.
+// Use this with a secret key for untrusted input, to prevent attackers from
+// precomputing colliding data.
+type SipHash struct {
+	K0 uint64
+	K1 uint64
+}
+
+// Name returns "siphash-" with fingerprint of the key.
+// The key itself is never recorded.
+func (s SipHash) Name() string {
+	return fmt.Sprintf("siphash-%08x", uint32(siphash.Hash(s.K0, s.K1, []byte("koron-go/bloomfilter"))))
+}
+
+// Sum64 computes a 64-bit hash of d with seed.
+func (s SipHash) Sum64(d []byte, seed uint64) uint64 {
+	return siphash.Hash(s.K0^seed, s.K1, d)
+}
+
+// HashByName returns Hash64 which has the name.
+// It returns nil for unknown names and keyed hashes (SipHash).
+func HashByName(name string) Hash64 {
+	for _, h := range []Hash64{MetroHash{}, XXHash{}, Murmur3{}, FNV{}} {
+		if h.Name() == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// Indexer computes indexes of data for filters.
+type Indexer struct {
+	// Hash is a family of hash functions. When nil, MetroHash is used.
+	Hash Hash64
+	// Seed is base of seeds for hash functions.
+	Seed uint64
+	// DoubleHashing derives k indexes from one 128-bit hash with enhanced
+	// double hashing (Kirsch-Mitzenmacher), instead of computing k hashes.
+	// Indexes are different from the default, so it must be used
+	// consistently for a filter.
+	DoubleHashing bool
+}
+
+func (ix Indexer) hash() Hash64 {
+	if ix.Hash == nil {
+		return MetroHash{}
+	}
+	return ix.Hash
+}
+
+// Name returns name of the hash algorithm.
+func (ix Indexer) Name() string {
+	return ix.hash().Name()
+}
+
+// seedFor returns a seed for n-th hash function.
+// It spreads bases of seeds, so filters with different seed bases don't share
+// hash functions.
+func seedFor(base uint64, n int) uint64 {
+	return base*0x9e3779b97f4a7c15 + uint64(n)
+}
+
+// sum128 computes a 128-bit hash of d for double hashing.
+func (ix Indexer) sum128(d []byte) (uint64, uint64) {
+	h := ix.hash()
+	if h128, ok := h.(Hash128); ok {
+		return h128.Sum128(d, seedFor(ix.Seed, 0))
+	}
+	return h.Sum64(d, seedFor(ix.Seed, 0)), h.Sum64(d, seedFor(ix.Seed, 1))
+}
+
+// index computes n-th index of d, which is in [0, m).
+// Use Indexes to compute all indexes of d at once.
+func (ix Indexer) index(d []byte, n int, m uint64) uint64 {
+	if ix.DoubleHashing {
+		a, b := ix.sum128(d)
+		i := uint64(n)
+		// closed form of the loop in Indexes.
+		return (a + i*b + i*(i-1)*(i-2)/6) % m
+	}
+	return ix.hash().Sum64(d, seedFor(ix.Seed, n)) % m
+}
+
+// Indexes appends k indexes of d, which are in [0, m), to dst and returns it.
+func (ix Indexer) Indexes(dst []uint64, d []byte, k int, m uint64) []uint64 {
+	if ix.DoubleHashing {
+		a, b := ix.sum128(d)
+		for i := 0; i < k; i++ {
+			dst = append(dst, a%m)
+			a += b
+			b += uint64(i)
+		}
+		return dst
+	}
+	h := ix.hash()
+	for i := 0; i < k; i++ {
+		dst = append(dst, h.Sum64(d, seedFor(ix.Seed, i))%m)
+	}
+	return dst
+}
+
+// indexBuffer is a buffer for Indexes which is allocated on stack.
+// It covers most of k, larger k causes allocations on heap.
+type indexBuffer [16]uint64
+
+func (o *options) indexer() Indexer {
+	return Indexer{Hash: o.hash, Seed: o.seed, DoubleHashing: o.doubleHashing}
+}
+
+type defaultHasher struct {
+	k  int
+	m  int
+	ix Indexer
 }
 
 // NewHasher creates a default hasher.
-func NewHasher(k, m int) Hasher {
-	return &metroHash{k: k, m: m}
+// Its hash functions can be configured by WithHash and WithSeed.
+// With WithBlocked, it creates a hasher for blocked layout.
+func NewHasher(k, m int, opts ...Option) Hasher {
+	o := newOptions(opts)
+	if o.blocked {
+		return newBlockedHasher(k, m, o.indexer())
+	}
+	return &defaultHasher{k: k, m: m, ix: o.indexer()}
 }
 
-func (mh *metroHash) Hash(_ context.Context, k int, d []byte) (int, error) {
+func (dh *defaultHasher) Hash(_ context.Context, k int, d []byte) (int, error) {
 	// FIXME: should be check that `k` is between 0 and (mh.k-1)?
-	h := metro.Hash64(d, uint64(k))
-	return int(h % uint64(mh.m)), nil
+	return int(dh.ix.index(d, k, uint64(dh.m))), nil
+}
+
+func (dh *defaultHasher) Indexes(_ context.Context, d []byte) ([]int, error) {
+	var buf indexBuffer
+	xx := dh.ix.Indexes(buf[:0], d, dh.k, uint64(dh.m))
+	indexes := make([]int, len(xx))
+	for i, x := range xx {
+		indexes[i] = int(x)
+	}
+	return indexes, nil
+}
+
+func (dh *defaultHasher) Identity() HasherIdentity {
+	return HasherIdentity{
+		Name:          dh.ix.Name(),
+		Seed:          dh.ix.Seed,
+		DoubleHashing: dh.ix.DoubleHashing,
+	}
 }
@@ -0,0 +1,240 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/dgryski/go-metro"
+)
+
+var testHashes = []Hash64{
+	MetroHash{},
+	XXHash{},
+	Murmur3{},
+	FNV{},
+	SipHash{K0: 0x0123456789abcdef, K1: 0xfedcba9876543210},
+}
+
+func TestIndexerDefault(t *testing.T) {
+	// default Indexer must be compatible with filters which were created
+	// before Hash64 was introduced.
+	const m, k = 1000, 7
+	var ix Indexer
+	for i := 0; i < 100; i++ {
+		d := []byte(strconv.Itoa(i))
+		got := ix.Indexes(nil, d, k, m)
+		for j, x := range got {
+			want := metro.Hash64(d, uint64(j)) % m
+			if x != want {
+				t.Fatalf("index mismatch: d=%q j=%d want=%d got=%d", d, j, want, x)
+			}
+		}
+	}
+	if got := ix.Name(); got != "metro" {
+		t.Errorf("unexpected name: want=metro got=%s", got)
+	}
+}
+
+func TestHash64(t *testing.T) {
+	names := map[string]struct{}{}
+	for _, h := range testHashes {
+		name := h.Name()
+		if _, ok := names[name]; ok {
+			t.Errorf("duplicated name: %s", name)
+		}
+		names[name] = struct{}{}
+		d := []byte("hello")
+		if h.Sum64(d, 0) != h.Sum64(d, 0) {
+			t.Errorf("%s: not deterministic", name)
+		}
+		if h.Sum64(d, 0) == h.Sum64(d, 1) {
+			t.Errorf("%s: seed is not used", name)
+		}
+		if h.Sum64(d, 0) == h.Sum64([]byte("world"), 0) {
+			t.Errorf("%s: data is not used", name)
+		}
+	}
+}
+
+func TestHashByName(t *testing.T) {
+	for _, h := range []Hash64{MetroHash{}, XXHash{}, Murmur3{}, FNV{}} {
+		got := HashByName(h.Name())
+		if got != h {
+			t.Errorf("HashByName(%q) returns %+v", h.Name(), got)
+		}
+	}
+	sh := SipHash{K0: 1, K1: 2}
+	if got := HashByName(sh.Name()); got != nil {
+		t.Errorf("keyed hash should not be resolved: %+v", got)
+	}
+	if got := HashByName("unknown"); got != nil {
+		t.Errorf("unknown hash should not be resolved: %+v", got)
+	}
+}
+
+func TestSipHashKey(t *testing.T) {
+	a := SipHash{K0: 1, K1: 2}
+	b := SipHash{K0: 1, K1: 3}
+	if a.Name() == b.Name() {
+		t.Errorf("names should be different with keys: %s", a.Name())
+	}
+	d := []byte("hello")
+	if a.Sum64(d, 0) == b.Sum64(d, 0) {
+		t.Error("hashes should be different with keys")
+	}
+}
+
+func TestHasherWithHash(t *testing.T) {
+	for _, h := range testHashes {
+		t.Run(h.Name(), func(t *testing.T) {
+			hs := NewHasher(7, 1000, WithHash(h), WithSeed(1234))
+			id := hs.(IdentifiableHasher).Identity()
+			if id.Name != h.Name() || id.Seed != 1234 {
+				t.Errorf("unexpected identity: %+v", id)
+			}
+			bf := New(1000, 7, hs, nil)
+			ctx := context.Background()
+			for i := 0; i < 50; i++ {
+				err := bf.PutString(ctx, strconv.Itoa(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i := 0; i < 50; i++ {
+				ok, err := bf.CheckString(ctx, strconv.Itoa(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					t.Errorf("BF: false negative for %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestFiltersWithHash(t *testing.T) {
+	for _, h := range testHashes {
+		t.Run(h.Name(), func(t *testing.T) {
+			vf, err := NewVBF(1000, 7, 3, WithHash(h))
+			if err != nil {
+				t.Fatal(err)
+			}
+			vf2 := NewVBF2(1000, 7, 8, WithHash(h))
+			vf3 := NewVBF3(1000, 7, 10, WithHash(h))
+			for i := 0; i < 50; i++ {
+				d := []byte(strconv.Itoa(i))
+				vf.Put(d)
+				vf2.Put(d)
+				vf3.Put(d, 10)
+			}
+			for i := 0; i < 50; i++ {
+				d := []byte(strconv.Itoa(i))
+				if !vf.Check(d, 0) {
+					t.Errorf("VBF: false negative for %q", d)
+				}
+				if !vf2.Check(d, 0) {
+					t.Errorf("VBF2: false negative for %q", d)
+				}
+				if !vf3.Check(d) {
+					t.Errorf("VBF3: false negative for %q", d)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexerDoubleHashing(t *testing.T) {
+	const m = 1000003
+	for _, h := range testHashes {
+		t.Run(h.Name(), func(t *testing.T) {
+			ix := Indexer{Hash: h, Seed: 99, DoubleHashing: true}
+			ix0 := Indexer{Hash: h, Seed: 99}
+			for i := 0; i < 100; i++ {
+				d := []byte(strconv.Itoa(i))
+				got := ix.Indexes(nil, d, 20, m)
+				if len(got) != 20 {
+					t.Fatalf("unexpected length: %d", len(got))
+				}
+				for j, x := range got {
+					if want := ix.index(d, j, m); x != want {
+						t.Fatalf("index mismatch: d=%q j=%d want=%d got=%d", d, j, want, x)
+					}
+				}
+				if eqUint64s(got, ix0.Indexes(nil, d, 20, m)) {
+					t.Fatalf("double hashing should generate other indexes: d=%q", d)
+				}
+			}
+		})
+	}
+}
+
+func eqUint64s(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBFDoubleHashingFalsePositive(t *testing.T) {
+	const n, fpRate = 10000, 0.01
+	for _, h := range testHashes {
+		t.Run(h.Name(), func(t *testing.T) {
+			ctx := context.Background()
+			bf, err := NewWithEstimates(n, fpRate, WithHash(h), WithDoubleHashing())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < n; i++ {
+				err := bf.PutString(ctx, strconv.Itoa(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			fp := 0
+			for i := n; i < n*11; i++ {
+				ok, err := bf.CheckString(ctx, strconv.Itoa(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					fp++
+				}
+			}
+			if got := float64(fp) / (n * 10); got > fpRate*1.5 {
+				t.Errorf("too high false positive rate: want<=%f got=%f", fpRate*1.5, got)
+			}
+		})
+	}
+}
+
+func benchmarkIndexer(b *testing.B, ix Indexer, k int) {
+	d := []byte("benchmark data for indexer")
+	buf := make([]uint64, 0, k)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = ix.Indexes(buf[:0], d, k, 1000003)
+	}
+}
+
+func BenchmarkIndexer_K7(b *testing.B) {
+	benchmarkIndexer(b, Indexer{}, 7)
+}
+
+func BenchmarkIndexer_K7_DoubleHashing(b *testing.B) {
+	benchmarkIndexer(b, Indexer{DoubleHashing: true}, 7)
+}
+
+func BenchmarkIndexer_K20(b *testing.B) {
+	benchmarkIndexer(b, Indexer{}, 20)
+}
+
+func BenchmarkIndexer_K20_DoubleHashing(b *testing.B) {
+	benchmarkIndexer(b, Indexer{DoubleHashing: true}, 20)
+}
@@ -0,0 +1,274 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Binary format of persisted filters:
+//
+//	magic     [4]byte  "KBF\x00"
+//	version   uint8    marshalVersion
+//	kind      uint8    marshalKindBF, marshalKindVBF3
+//	flags     uint8    bit 0: double hashing, bit 1: blocked, others are reserved (zero)
+//	m         uint64
+//	k         uint64
+//	seed      uint64
+//	hasher    uint8 + []byte  (name of hash algorithm)
+//	...       kind specific payload
+//	checksum  uint32   CRC-32 (IEEE) of all preceding bytes
+//
+// All integers are big endian.
+
+const (
+	marshalMagic   = "KBF\x00"
+	marshalVersion = 1
+)
+
+const (
+	// marshalFlagDoubleHashing is set when HasherIdentity.DoubleHashing is
+	// true.
+	marshalFlagDoubleHashing uint8 = 0x01
+
+	// marshalFlagBlocked is set when HasherIdentity.Blocked is true.
+	marshalFlagBlocked uint8 = 0x02
+)
+
+const (
+	marshalKindBF   uint8 = 1
+	marshalKindVBF3 uint8 = 2
+)
+
+type marshalHeader struct {
+	kind   uint8
+	flags  uint8
+	m      uint64
+	k      uint64
+	hasher HasherIdentity
+}
+
+// verify checks that the header matches with other (expected) one.
+func (h marshalHeader) verify(want marshalHeader) error {
+	if h.kind != want.kind {
+		return fmt.Errorf("kind mismatch: want=%d got=%d", want.kind, h.kind)
+	}
+	if h.flags != want.flags {
+		return fmt.Errorf("flags mismatch: want=%#02x got=%#02x", want.flags, h.flags)
+	}
+	if h.m != want.m || h.k != want.k {
+		return fmt.Errorf("parameter mismatch: want=(m=%d k=%d) got=(m=%d k=%d)", want.m, want.k, h.m, h.k)
+	}
+	if h.hasher != want.hasher {
+		return fmt.Errorf("hasher mismatch: want=%+v got=%+v", want.hasher, h.hasher)
+	}
+	return nil
+}
+
+type binaryWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func newBinaryWriter(w io.Writer) *binaryWriter {
+	return &binaryWriter{w: w, crc: crc32.NewIEEE()}
+}
+
+func (bw *binaryWriter) write(p []byte) {
+	if bw.err != nil {
+		return
+	}
+	n, err := bw.w.Write(p)
+	bw.n += int64(n)
+	bw.crc.Write(p[:n])
+	bw.err = err
+}
+
+func (bw *binaryWriter) uint8(v uint8) {
+	bw.buf[0] = v
+	bw.write(bw.buf[:1])
+}
+
+func (bw *binaryWriter) uint64(v uint64) {
+	binary.BigEndian.PutUint64(bw.buf[:], v)
+	bw.write(bw.buf[:])
+}
+
+func (bw *binaryWriter) bytes(b []byte) {
+	bw.uint64(uint64(len(b)))
+	bw.write(b)
+}
+
+func (bw *binaryWriter) header(h marshalHeader) {
+	if len(h.hasher.Name) > 255 {
+		bw.err = fmt.Errorf("too long hasher name: %q", h.hasher.Name)
+		return
+	}
+	bw.write([]byte(marshalMagic))
+	bw.uint8(marshalVersion)
+	flags := h.flags
+	if h.hasher.DoubleHashing {
+		flags |= marshalFlagDoubleHashing
+	}
+	if h.hasher.Blocked {
+		flags |= marshalFlagBlocked
+	}
+	bw.uint8(h.kind)
+	bw.uint8(flags)
+	bw.uint64(h.m)
+	bw.uint64(h.k)
+	bw.uint64(h.hasher.Seed)
+	bw.uint8(uint8(len(h.hasher.Name)))
+	bw.write([]byte(h.hasher.Name))
+}
+
+// finish writes the checksum and returns the number of written bytes.
+func (bw *binaryWriter) finish() (int64, error) {
+	if bw.err != nil {
+		return bw.n, bw.err
+	}
+	binary.BigEndian.PutUint32(bw.buf[:4], bw.crc.Sum32())
+	n, err := bw.w.Write(bw.buf[:4])
+	bw.n += int64(n)
+	return bw.n, err
+}
+
+type binaryReader struct {
+	r   io.Reader
+	crc hash.Hash32
+	n   int64
+	err error
+	buf [8]byte
+}
+
+func newBinaryReader(r io.Reader) *binaryReader {
+	return &binaryReader{r: r, crc: crc32.NewIEEE()}
+}
+
+func (br *binaryReader) read(p []byte) {
+	if br.err != nil {
+		return
+	}
+	n, err := io.ReadFull(br.r, p)
+	br.n += int64(n)
+	br.crc.Write(p[:n])
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		br.err = err
+	}
+}
+
+func (br *binaryReader) uint8() uint8 {
+	br.read(br.buf[:1])
+	return br.buf[0]
+}
+
+func (br *binaryReader) uint64() uint64 {
+	br.read(br.buf[:])
+	return binary.BigEndian.Uint64(br.buf[:])
+}
+
+// bytesInto reads length prefixed bytes into p. The length should be equal
+// to len(p).
+func (br *binaryReader) bytesInto(p []byte) {
+	n := br.uint64()
+	if br.err != nil {
+		return
+	}
+	if n != uint64(len(p)) {
+		br.err = fmt.Errorf("data length mismatch: want=%d got=%d", len(p), n)
+		return
+	}
+	br.read(p)
+}
+
+// marshalChunkSize is the max number of bytes which bytesN allocates before
+// reading them.
+const marshalChunkSize = 64 * 1024
+
+// bytesN reads length prefixed bytes, which should be n bytes. n may come
+// from untrusted input, so it allocates memory by chunks while reading, and
+// fails for short data without allocating whole n bytes.
+func (br *binaryReader) bytesN(n uint64) []byte {
+	l := br.uint64()
+	if br.err != nil {
+		return nil
+	}
+	if l != n {
+		br.err = fmt.Errorf("data length mismatch: want=%d got=%d", n, l)
+		return nil
+	}
+	c := uint64(marshalChunkSize)
+	if n < c {
+		c = n
+	}
+	p := make([]byte, 0, c)
+	for uint64(len(p)) < n {
+		c := n - uint64(len(p))
+		if c > marshalChunkSize {
+			c = marshalChunkSize
+		}
+		off := len(p)
+		p = append(p, make([]byte, c)...)
+		br.read(p[off:])
+		if br.err != nil {
+			return nil
+		}
+	}
+	return p
+}
+
+func (br *binaryReader) header() marshalHeader {
+	var h marshalHeader
+	var magic [len(marshalMagic)]byte
+	br.read(magic[:])
+	if br.err == nil && string(magic[:]) != marshalMagic {
+		br.err = fmt.Errorf("invalid magic: %q", magic[:])
+		return h
+	}
+	if v := br.uint8(); br.err == nil && v != marshalVersion {
+		br.err = fmt.Errorf("unsupported version: %d", v)
+		return h
+	}
+	h.kind = br.uint8()
+	flags := br.uint8()
+	h.hasher.DoubleHashing = flags&marshalFlagDoubleHashing != 0
+	h.hasher.Blocked = flags&marshalFlagBlocked != 0
+	h.flags = flags &^ (marshalFlagDoubleHashing | marshalFlagBlocked)
+	h.m = br.uint64()
+	h.k = br.uint64()
+	h.hasher.Seed = br.uint64()
+	name := make([]byte, br.uint8())
+	br.read(name)
+	h.hasher.Name = string(name)
+	return h
+}
+
+// finish reads and verifies the checksum, then returns the number of read
+// bytes.
+func (br *binaryReader) finish() (int64, error) {
+	if br.err != nil {
+		return br.n, br.err
+	}
+	want := br.crc.Sum32()
+	n, err := io.ReadFull(br.r, br.buf[:4])
+	br.n += int64(n)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return br.n, err
+	}
+	if got := binary.BigEndian.Uint32(br.buf[:4]); got != want {
+		return br.n, fmt.Errorf("checksum mismatch: want=%08x got=%08x", want, got)
+	}
+	return br.n, nil
+}
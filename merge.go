@@ -0,0 +1,148 @@
+package bloomfilter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// checkMergeParams checks that parameters m and k of two filters match.
+func checkMergeParams(m0, k0, m1, k1 int) error {
+	if m0 != m1 || k0 != k1 {
+		return fmt.Errorf("parameter mismatch: want=(m=%d k=%d) got=(m=%d k=%d)", m0, k0, m1, k1)
+	}
+	return nil
+}
+
+// checkMergeIndexer checks that two filters compute same indexes.
+func checkMergeIndexer(ix0, ix1 Indexer) error {
+	if ix0.Name() != ix1.Name() || ix0.Seed != ix1.Seed || ix0.DoubleHashing != ix1.DoubleHashing {
+		return fmt.Errorf("hasher mismatch: want=(hash=%s seed=%d double_hashing=%t) got=(hash=%s seed=%d double_hashing=%t)",
+			ix0.Name(), ix0.Seed, ix0.DoubleHashing, ix1.Name(), ix1.Seed, ix1.DoubleHashing)
+	}
+	return nil
+}
+
+// checkMergeHasher checks that two hashers compute same indexes, by their
+// identities. Hashers which are not identifiable must be same value.
+func checkMergeHasher(h0, h1 Hasher) error {
+	ih0, ok0 := h0.(IdentifiableHasher)
+	ih1, ok1 := h1.(IdentifiableHasher)
+	if ok0 && ok1 {
+		if id0, id1 := ih0.Identity(), ih1.Identity(); id0 != id1 {
+			return fmt.Errorf("hasher mismatch: want=%+v got=%+v", id0, id1)
+		}
+		return nil
+	}
+	// comparing values of an uncomparable type panics.
+	t0, t1 := reflect.TypeOf(h0), reflect.TypeOf(h1)
+	if t0 == t1 && (t0 == nil || t0.Comparable()) && h0 == h1 {
+		return nil
+	}
+	return errors.New("hasher is not identifiable")
+}
+
+// mergeStores checks that two BF are compatible and returns their stores.
+func (bf *BF) mergeStores(other *BF) (MemoryStore, MemoryStore, error) {
+	err := checkMergeParams(bf.m, bf.k, other.m, other.k)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = checkMergeHasher(bf.h, other.h)
+	if err != nil {
+		return nil, nil, err
+	}
+	ms0, ok := bf.s.(MemoryStore)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported store: %T", bf.s)
+	}
+	ms1, ok := other.s.(MemoryStore)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported store of other: %T", other.s)
+	}
+	if len(ms0) != len(ms1) {
+		return nil, nil, fmt.Errorf("store size mismatch: want=%d got=%d", len(ms0), len(ms1))
+	}
+	return ms0, ms1, nil
+}
+
+// Union merges other filter into the filter. After that, the filter answers
+// true for all items which were put to either filters.
+// Both filters must have same m, k, hasher and MemoryStore.
+func (bf *BF) Union(other *BF) error {
+	ms0, ms1, err := bf.mergeStores(other)
+	if err != nil {
+		return err
+	}
+	for i, v := range ms1 {
+		ms0[i] |= v
+	}
+	return nil
+}
+
+// Intersect makes the filter an intersection with other filter. After that,
+// the filter answers true for items which were put to both filters, and it may
+// answer true with higher false positive rate than a filter which was built
+// from the intersection of items.
+// Both filters must have same m, k, hasher and MemoryStore.
+func (bf *BF) Intersect(other *BF) error {
+	ms0, ms1, err := bf.mergeStores(other)
+	if err != nil {
+		return err
+	}
+	for i, v := range ms1 {
+		ms0[i] &= v
+	}
+	return nil
+}
+
+// Merge merges other filter into the filter, by taking larger value of each
+// register. Both filters must have same m, k, nbits and hasher.
+func (vf *VBF2) Merge(other *VBF2) error {
+	err := checkMergeParams(vf.m, vf.k, other.m, other.k)
+	if err != nil {
+		return err
+	}
+	if vf.nbits != other.nbits {
+		return fmt.Errorf("nbits mismatch: want=%d got=%d", vf.nbits, other.nbits)
+	}
+	err = checkMergeIndexer(vf.ix, other.ix)
+	if err != nil {
+		return err
+	}
+	for x := 0; x < vf.m; x++ {
+		if v := other.getData(x); v > vf.getData(x) {
+			vf.putData(x, v)
+		}
+	}
+	return nil
+}
+
+// Merge merges other filter into the filter. For each register, it keeps
+// the longer remaining life of two filters, which is translated into the
+// generation window of the filter. Expired registers of other are ignored.
+// Both filters must have same m, k, max life and hasher, while their
+// generation windows may differ.
+func (f *VBF3) Merge(other *VBF3) error {
+	err := checkMergeParams(f.m, f.k, other.m, other.k)
+	if err != nil {
+		return err
+	}
+	if f.max != other.max {
+		return fmt.Errorf("max life mismatch: want=%d got=%d", f.max, other.max)
+	}
+	err = checkMergeIndexer(f.ix, other.ix)
+	if err != nil {
+		return err
+	}
+	for x := range f.data {
+		life := other.currLife(x)
+		if life == 0 {
+			continue
+		}
+		if curr := f.currLife(x); curr == 0 || life > curr {
+			f.data[x] = f.m255p1add(f.bottom, life-1)
+		}
+	}
+	return nil
+}
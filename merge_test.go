@@ -0,0 +1,205 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestBFUnionIntersect(t *testing.T) {
+	ctx := context.Background()
+	newBF := func(from, to int) *BF {
+		bf := New(10000, 7, nil, nil)
+		for i := from; i < to; i++ {
+			err := bf.PutString(ctx, strconv.Itoa(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return bf
+	}
+	check := func(bf *BF, from, to int) {
+		t.Helper()
+		for i := from; i < to; i++ {
+			ok, err := bf.CheckString(ctx, strconv.Itoa(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !ok {
+				t.Errorf("false negative for %d", i)
+			}
+		}
+	}
+
+	u := newBF(0, 100)
+	err := u.Union(newBF(50, 150))
+	if err != nil {
+		t.Fatalf("union failed: %s", err)
+	}
+	check(u, 0, 150)
+
+	x := newBF(0, 100)
+	err = x.Intersect(newBF(50, 150))
+	if err != nil {
+		t.Fatalf("intersect failed: %s", err)
+	}
+	check(x, 50, 100)
+	fp := 0
+	for i := 100; i < 150; i++ {
+		ok, _ := x.CheckString(ctx, strconv.Itoa(i))
+		if ok {
+			fp++
+		}
+	}
+	if fp > 5 {
+		t.Errorf("too many items remain after intersect: %d", fp)
+	}
+}
+
+func TestBFUnionMismatch(t *testing.T) {
+	bf := New(1000, 7, nil, nil)
+	for i, other := range []*BF{
+		New(1001, 7, nil, nil),
+		New(1000, 6, nil, nil),
+		New(1000, 7, NewHasher(7, 1000, WithSeed(1)), nil),
+		New(1000, 7, NewHasher(7, 1000, WithHash(FNV{})), nil),
+		New(1000, 7, NewHasher(7, 1000, WithBlocked()), nil),
+		New(1000, 7, nil, NewAtomicMemoryStore(1000)),
+	} {
+		if err := bf.Union(other); err == nil {
+			t.Errorf("#%d union should fail", i)
+		}
+		if err := bf.Intersect(other); err == nil {
+			t.Errorf("#%d intersect should fail", i)
+		}
+	}
+	if err := New(1000, 7, nil, NewAtomicMemoryStore(1000)).Union(bf); err == nil {
+		t.Error("union with unsupported store should fail")
+	}
+	// same hasher instance is compatible even if it is not identifiable.
+	h := &modHasher{m: 1000}
+	if err := New(1000, 7, h, nil).Union(New(1000, 7, h, nil)); err != nil {
+		t.Errorf("union with same hasher failed: %s", err)
+	}
+	if err := New(1000, 7, h, nil).Union(New(1000, 7, &modHasher{m: 1000}, nil)); err == nil {
+		t.Error("union with unidentifiable hasher should fail")
+	}
+	// hashers of uncomparable types are not identifiable.
+	fh := funcHasher(h.Hash)
+	if err := New(1000, 7, fh, nil).Union(New(1000, 7, fh, nil)); err == nil {
+		t.Error("union with uncomparable hasher should fail")
+	}
+	if err := New(1000, 7, fh, nil).Union(New(1000, 7, h, nil)); err == nil {
+		t.Error("union with different hashers should fail")
+	}
+}
+
+// funcHasher is a Hasher of an uncomparable type.
+type funcHasher func(ctx context.Context, k int, d []byte) (int, error)
+
+func (fh funcHasher) Hash(ctx context.Context, k int, d []byte) (int, error) {
+	return fh(ctx, k, d)
+}
+
+// modHasher is a Hasher which is not identifiable.
+type modHasher struct {
+	m int
+}
+
+func (mh *modHasher) Hash(_ context.Context, k int, d []byte) (int, error) {
+	var h int
+	for _, c := range d {
+		h = h*31 + int(c)
+	}
+	return (h + k) % mh.m, nil
+}
+
+func TestVBF2Merge(t *testing.T) {
+	for _, nbits := range []uint8{1, 2, 3, 4, 5, 6, 7, 8} {
+		a := NewVBF2(1000, 7, nbits)
+		b := NewVBF2(1000, 7, nbits)
+		a.Put([]byte("foo"))
+		b.Put([]byte("bar"))
+		a.Subtract(1)
+		err := a.Merge(b)
+		if err != nil {
+			t.Fatalf("nbits=%d: merge failed: %s", nbits, err)
+		}
+		if !a.Check([]byte("bar"), a.max-1) {
+			t.Errorf("nbits=%d: bar should have max value", nbits)
+		}
+		if nbits > 1 && !a.Check([]byte("foo"), 0) {
+			t.Errorf("nbits=%d: foo should remain", nbits)
+		}
+		for x := 0; x < a.m; x++ {
+			if v, w := a.getData(x), b.getData(x); v < w {
+				t.Fatalf("nbits=%d: register #%d is smaller than other: %d < %d", nbits, x, v, w)
+			}
+		}
+	}
+
+	a := NewVBF2(1000, 7, 8)
+	for i, other := range []*VBF2{
+		NewVBF2(1001, 7, 8),
+		NewVBF2(1000, 6, 8),
+		NewVBF2(1000, 7, 4),
+		NewVBF2(1000, 7, 8, WithHash(XXHash{})),
+		NewVBF2(1000, 7, 8, WithDoubleHashing()),
+	} {
+		if err := a.Merge(other); err == nil {
+			t.Errorf("#%d merge should fail", i)
+		}
+	}
+}
+
+func TestVBF3Merge(t *testing.T) {
+	a := NewVBF3(1000, 7, 10)
+	b := NewVBF3(1000, 7, 10)
+	// move windows of two filters differently, across the end of the ring.
+	a.AdvanceGeneration(250)
+	b.AdvanceGeneration(3)
+
+	a.Put([]byte("foo"), 2)
+	a.Put([]byte("baz"), 9)
+	b.Put([]byte("foo"), 5)
+	b.Put([]byte("bar"), 3)
+	b.Put([]byte("expired"), 1)
+	b.Put([]byte("baz"), 4)
+	b.AdvanceGeneration(1)
+
+	err := a.Merge(b)
+	if err != nil {
+		t.Fatalf("merge failed: %s", err)
+	}
+	for _, tc := range []struct {
+		d    string
+		life int
+	}{
+		{"foo", 4},
+		{"bar", 2},
+		{"baz", 9},
+		{"expired", 0},
+	} {
+		d := []byte(tc.d)
+		for i := 0; i <= tc.life; i++ {
+			c := *a
+			c.data = append([]byte(nil), a.data...)
+			c.AdvanceGeneration(uint8(i))
+			want := i < tc.life
+			if got := c.Check(d); got != want {
+				t.Errorf("%s after %d generations: want=%t got=%t", tc.d, i, want, got)
+			}
+		}
+	}
+
+	for i, other := range []*VBF3{
+		NewVBF3(1001, 7, 10),
+		NewVBF3(1000, 6, 10),
+		NewVBF3(1000, 7, 11),
+		NewVBF3(1000, 7, 10, WithSeed(1)),
+	} {
+		if err := a.Merge(other); err == nil {
+			t.Errorf("#%d merge should fail", i)
+		}
+	}
+}
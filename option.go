@@ -0,0 +1,129 @@
+package bloomfilter
+
+// Option configures filters which are created by constructors.
+type Option func(*options)
+
+type options struct {
+	hasher Hasher
+	store  Store
+	hash   Hash64
+	seed   uint64
+
+	doubleHashing bool
+	blocked       bool
+	autoSweep     bool
+
+	clock Clock
+
+	// for SBF
+	storeFactory StoreFactory
+	growth       int
+	ratio        float64
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHasher specifies a Hasher for BF.
+func WithHasher(h Hasher) Option {
+	return func(o *options) {
+		o.hasher = h
+	}
+}
+
+// WithStore specifies a Store for BF.
+func WithStore(s Store) Option {
+	return func(o *options) {
+		o.store = s
+	}
+}
+
+// WithHash specifies a family of hash functions.
+// It is available for all filters and NewHasher.
+func WithHash(h Hash64) Option {
+	return func(o *options) {
+		o.hash = h
+	}
+}
+
+// WithDoubleHashing enables double hashing, which derives k indexes from one
+// 128-bit hash. It is available for all filters and NewHasher.
+// Filters with and without double hashing are incompatible.
+func WithDoubleHashing() Option {
+	return func(o *options) {
+		o.doubleHashing = true
+	}
+}
+
+// WithBlocked enables blocked (partitioned) layout for NewHasher,
+// NewWithEstimates and NewSBF. All k indexes of an item fall in one block of
+// 512 bits (a cache line), so Check on large filters causes fewer cache misses
+// in exchange for a little higher false positive rate.
+// m should be a multiple of 512, otherwise the remainder bits are not used.
+func WithBlocked() Option {
+	return func(o *options) {
+		o.blocked = true
+	}
+}
+
+// WithAutoSweep lets VBF3Redis.AdvanceGeneration sweep registers when
+// advancing would resurrect expired registers, instead of returning
+// WraparoundError. The sweep may take long time for large filters.
+func WithAutoSweep() Option {
+	return func(o *options) {
+		o.autoSweep = true
+	}
+}
+
+// WithClock specifies a Clock for NewTimedVBF3, to advance generations
+// without sleeping in tests.
+func WithClock(c Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// withIndexer copies configurations of Indexer.
+func withIndexer(ix Indexer) Option {
+	return func(o *options) {
+		o.hash = ix.Hash
+		o.seed = ix.Seed
+		o.doubleHashing = ix.DoubleHashing
+	}
+}
+
+// WithSeed specifies a base of seeds for hash functions.
+func WithSeed(seed uint64) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+// WithStoreFactory specifies a StoreFactory which creates stores of slices
+// for SBF. SBF keeps the number of slices and their counts only in memory,
+// see SBF.
+func WithStoreFactory(f StoreFactory) Option {
+	return func(o *options) {
+		o.storeFactory = f
+	}
+}
+
+// WithGrowth specifies growth factor of capacities of slices for SBF.
+func WithGrowth(growth int) Option {
+	return func(o *options) {
+		o.growth = growth
+	}
+}
+
+// WithTighteningRatio specifies tightening ratio of false positive rates of
+// slices for SBF.
+func WithTighteningRatio(ratio float64) Option {
+	return func(o *options) {
+		o.ratio = ratio
+	}
+}
@@ -2,29 +2,35 @@ package bloomfilter
 
 import (
 	"context"
+	"fmt"
 
-	"github.com/dgryski/go-metro"
 	"github.com/go-redis/redis/v8"
 )
 
 // Redis provides volatile bloom filter which use redis as store.
+// It stores only registers in Redis, not parameters (m, k, hash, seed and
+// double hashing). So it can't detect a mismatch of them between processes,
+// which causes false negatives silently. Use same parameters for a name
+// always, or use VBF3Redis which verifies them.
 type Redis struct {
-	c redis.UniversalClient
-	n string
-	m int
-	k int
+	c  redis.UniversalClient
+	n  string
+	m  int
+	k  int
+	ix Indexer
 }
 
-//const redisNbits = 8
+// const redisNbits = 8
 const redisMax = 255
 
 // NewRedis creates a new Redis bloom filter.
-func NewRedis(uc redis.UniversalClient, name string, m, k int) *Redis {
+func NewRedis(uc redis.UniversalClient, name string, m, k int, opts ...Option) *Redis {
 	return &Redis{
-		c: uc,
-		n: name,
-		m: m,
-		k: k,
+		c:  uc,
+		n:  name,
+		m:  m,
+		k:  k,
+		ix: newOptions(opts).indexer(),
 	}
 }
 
@@ -33,9 +39,9 @@ func (rf *Redis) Put(ctx context.Context, d []byte) error {
 	// bits be available.
 	args := make([]interface{}, 0, 2+4*rf.k)
 	args = append(args, "OVERFLOW", "SAT")
-	for i := 0; i < rf.k; i++ {
-		x := int64(metro.Hash64(d, uint64(i)) % uint64(rf.m))
-		args = append(args, "INCRBY", "u8", x*8, redisMax)
+	var buf indexBuffer
+	for _, x := range rf.ix.Indexes(buf[:0], d, rf.k, uint64(rf.m)) {
+		args = append(args, "INCRBY", "u8", int64(x)*8, redisMax)
 	}
 	_, err := rf.c.BitField(ctx, rf.n, args...).Result()
 	if err != nil {
@@ -47,9 +53,9 @@ func (rf *Redis) Put(ctx context.Context, d []byte) error {
 func (rf *Redis) Check(ctx context.Context, d []byte, bias uint8) (bool, error) {
 	// using "BITFIELD GET ... GET ..." obtain all values by a command
 	args := make([]interface{}, 0, 3*rf.k)
-	for i := 0; i < rf.k; i++ {
-		x := int64(metro.Hash64(d, uint64(i)) % uint64(rf.m))
-		args = append(args, "GET", "u8", x*8)
+	var buf indexBuffer
+	for _, x := range rf.ix.Indexes(buf[:0], d, rf.k, uint64(rf.m)) {
+		args = append(args, "GET", "u8", int64(x)*8)
 	}
 	r, err := rf.c.BitField(ctx, rf.n, args...).Result()
 	if err != nil {
@@ -63,6 +69,111 @@ func (rf *Redis) Check(ctx context.Context, d []byte, bias uint8) (bool, error)
 	return true, nil
 }
 
+// CheckAndPut checks a byte array is available with bias or not, and puts
+// it. It returns true when it was available before.
+// It is done by a BITFIELD command atomically: GETs then INCRBYs.
+func (rf *Redis) CheckAndPut(ctx context.Context, d []byte, bias uint8) (bool, error) {
+	var buf indexBuffer
+	xx := rf.ix.Indexes(buf[:0], d, rf.k, uint64(rf.m))
+	args := make([]interface{}, 0, 2+7*len(xx))
+	for _, x := range xx {
+		args = append(args, "GET", "u8", int64(x)*8)
+	}
+	args = append(args, "OVERFLOW", "SAT")
+	for _, x := range xx {
+		args = append(args, "INCRBY", "u8", int64(x)*8, redisMax)
+	}
+	r, err := rf.c.BitField(ctx, rf.n, args...).Result()
+	if err != nil {
+		return false, err
+	}
+	if len(r) != 2*len(xx) {
+		return false, fmt.Errorf("unexpected length of response for check and put: %+v", r)
+	}
+	for _, v := range r[:len(xx)] {
+		if v <= int64(bias) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// uniqueIndexes returns unique indexes in all groups, and positions of each
+// index in them.
+func uniqueIndexes(all [][]uint64) ([]uint64, map[uint64]int) {
+	pos := make(map[uint64]int)
+	uniq := make([]uint64, 0, len(all))
+	for _, xx := range all {
+		for _, x := range xx {
+			if _, ok := pos[x]; ok {
+				continue
+			}
+			pos[x] = len(uniq)
+			uniq = append(uniq, x)
+		}
+	}
+	return uniq, pos
+}
+
+// indexesAll returns indexes for each data.
+func (rf *Redis) indexesAll(dd [][]byte) [][]uint64 {
+	all := make([][]uint64, len(dd))
+	for i, d := range dd {
+		all[i] = rf.ix.Indexes(nil, d, rf.k, uint64(rf.m))
+	}
+	return all
+}
+
+// PutAll puts byte arrays to the filter, by a BITFIELD command.
+func (rf *Redis) PutAll(ctx context.Context, dd [][]byte) error {
+	if len(dd) == 0 {
+		return nil
+	}
+	uniq, _ := uniqueIndexes(rf.indexesAll(dd))
+	args := make([]interface{}, 0, 2+4*len(uniq))
+	args = append(args, "OVERFLOW", "SAT")
+	for _, x := range uniq {
+		args = append(args, "INCRBY", "u8", int64(x)*8, redisMax)
+	}
+	_, err := rf.c.BitField(ctx, rf.n, args...).Result()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckAll checks byte arrays are available with bias or not, by a BITFIELD
+// command. It returns results in the order of dd.
+func (rf *Redis) CheckAll(ctx context.Context, dd [][]byte, bias uint8) ([]bool, error) {
+	if len(dd) == 0 {
+		return nil, nil
+	}
+	all := rf.indexesAll(dd)
+	uniq, pos := uniqueIndexes(all)
+	args := make([]interface{}, 0, 3*len(uniq))
+	for _, x := range uniq {
+		args = append(args, "GET", "u8", int64(x)*8)
+	}
+	r, err := rf.c.BitField(ctx, rf.n, args...).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(r) != len(uniq) {
+		return nil, fmt.Errorf("unexpected length of response for check all: want=%d got=%d", len(uniq), len(r))
+	}
+	rr := make([]bool, len(dd))
+	for i, xx := range all {
+		rr[i] = true
+		for _, x := range xx {
+			if r[pos[x]] <= int64(bias) {
+				rr[i] = false
+				break
+			}
+		}
+	}
+	return rr, nil
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -189,3 +189,84 @@ func TestRedisSubtractOverflow(t *testing.T) {
 		t.Logf("too big error rate: %.2f%% failure=%d total=%d", rate, failure, total)
 	}
 }
+
+func TestRedisCheckAndPut(t *testing.T) {
+	c := newTestRedisClient(t)
+	rf := NewRedis(c, t.Name(), 1000, 7)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		c.Del(ctx, t.Name())
+	})
+	for i, want := range []bool{false, true, true} {
+		got, err := rf.CheckAndPut(ctx, []byte("foo"), 0)
+		if err != nil {
+			t.Fatalf("#%d check and put failed: %s", i, err)
+		}
+		if got != want {
+			t.Errorf("#%d unexpected check and put: want=%t got=%t", i, want, got)
+		}
+	}
+	err := rf.Subtract(ctx, 255)
+	if err != nil {
+		t.Fatalf("subtract failed: %s", err)
+	}
+	got, err := rf.CheckAndPut(ctx, []byte("foo"), 0)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	if got {
+		t.Error("foo should be expired")
+	}
+	has, err := rf.Check(ctx, []byte("foo"), 254)
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("foo should be put by check and put")
+	}
+}
+
+func TestRedisPutAllCheckAll(t *testing.T) {
+	c := newTestRedisClient(t)
+	rf := NewRedis(c, t.Name(), 10000, 7)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		c.Del(ctx, t.Name())
+	})
+	var put, all [][]byte
+	for i := 0; i < 200; i++ {
+		d := []byte(strconv.Itoa(i))
+		if i%2 == 0 {
+			// duplicated data are put once.
+			put = append(put, d, d)
+		}
+		all = append(all, d)
+	}
+	err := rf.PutAll(ctx, put)
+	if err != nil {
+		t.Fatalf("put all failed: %s", err)
+	}
+	rr, err := rf.CheckAll(ctx, all, 0)
+	if err != nil {
+		t.Fatalf("check all failed: %s", err)
+	}
+	if len(rr) != len(all) {
+		t.Fatalf("unexpected number of results: want=%d got=%d", len(all), len(rr))
+	}
+	for i, d := range all {
+		want, err := rf.Check(ctx, d, 0)
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if rr[i] != want {
+			t.Errorf("result mismatch for %s: want=%t got=%t", d, want, rr[i])
+		}
+		if i%2 == 0 && !rr[i] {
+			t.Errorf("false negative for %s", d)
+		}
+	}
+	rr, err = rf.CheckAll(ctx, nil, 0)
+	if err != nil || len(rr) != 0 {
+		t.Errorf("check all for empty should be empty: %v %v", rr, err)
+	}
+}
@@ -0,0 +1,58 @@
+package bloomfilter
+
+// registers is an array of unsigned integer registers of 1~16 bits width,
+// which are packed into bytes without gaps.
+//
+// A register x occupies bits from x*width to (x+1)*width-1, counting from
+// MSB of the first byte, and its value is stored in big endian. It is same
+// layout with "BITFIELD key GET u{width} #{x}" of Redis, and registers of
+// 1, 2, 4, 8 and 16 bits never cross boundaries of bytes.
+// Registers don't know their width, so callers should always pass same
+// width.
+type registers []byte
+
+// newRegisters creates registers which have n registers of width bits.
+func newRegisters(n, width int) registers {
+	return make(registers, (n*width+7)/8)
+}
+
+// window returns an index of the first byte and a shift for a register. A
+// register is fit in a 24 bits window which starts at the byte, and the shift
+// is a number of bits right of the register in the window.
+func (r registers) window(x, width int) (int, uint) {
+	off := x * width
+	return off / 8, uint(24 - off%8 - width)
+}
+
+// load reads a 24 bits window at i. Bytes out of the array are read as zero.
+func (r registers) load(i int) uint32 {
+	var w uint32
+	for j := 0; j < 3 && i+j < len(r); j++ {
+		w |= uint32(r[i+j]) << (16 - 8*j)
+	}
+	return w
+}
+
+// get returns a value of a register x.
+func (r registers) get(x, width int) uint16 {
+	if width == 8 {
+		return uint16(r[x])
+	}
+	i, shift := r.window(x, width)
+	mask := uint32(1)<<width - 1
+	return uint16((r.load(i) >> shift) & mask)
+}
+
+// set puts a value to a register x. Bits of v over width are ignored.
+func (r registers) set(x, width int, v uint16) {
+	if width == 8 {
+		r[x] = uint8(v)
+		return
+	}
+	i, shift := r.window(x, width)
+	mask := (uint32(1)<<width - 1) << shift
+	w := r.load(i)&^mask | (uint32(v)<<shift)&mask
+	for j := 0; j < 3 && i+j < len(r); j++ {
+		r[i+j] = uint8(w >> (16 - 8*j))
+	}
+}
@@ -0,0 +1,137 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// refRegisters is a naive implementation of registers, which keeps each bit
+// in a bool.
+type refRegisters struct {
+	width int
+	bits  []bool
+}
+
+func newRefRegisters(n, width int) *refRegisters {
+	return &refRegisters{width: width, bits: make([]bool, n*width)}
+}
+
+func (rr *refRegisters) get(x int) uint16 {
+	var v uint16
+	for i := 0; i < rr.width; i++ {
+		v <<= 1
+		if rr.bits[x*rr.width+i] {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func (rr *refRegisters) set(x int, v uint16) {
+	for i := rr.width - 1; i >= 0; i-- {
+		rr.bits[x*rr.width+i] = v&1 != 0
+		v >>= 1
+	}
+}
+
+// bytes packs bits from MSB of the first byte.
+func (rr *refRegisters) bytes() []byte {
+	b := make([]byte, (len(rr.bits)+7)/8)
+	for i, v := range rr.bits {
+		if v {
+			b[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	return b
+}
+
+func checkRegisters(tb testing.TB, r registers, rr *refRegisters, n int) {
+	tb.Helper()
+	for x := 0; x < n; x++ {
+		if got, want := r.get(x, rr.width), rr.get(x); got != want {
+			tb.Fatalf("register mismatch: width=%d n=%d x=%d want=%d got=%d", rr.width, n, x, want, got)
+		}
+	}
+	if want := rr.bytes(); !bytes.Equal(r, want) {
+		tb.Fatalf("layout mismatch: width=%d n=%d\nwant=%x\n got=%x", rr.width, n, want, []byte(r))
+	}
+}
+
+func TestRegistersRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for width := 1; width <= 16; width++ {
+		for _, n := range []int{1, 2, 3, 7, 8, 9, 100, 1001} {
+			r := newRegisters(n, width)
+			rr := newRefRegisters(n, width)
+			if want := len(rr.bytes()); len(r) != want {
+				t.Fatalf("unexpected length: width=%d n=%d want=%d got=%d", width, n, want, len(r))
+			}
+			for i := 0; i < n*8; i++ {
+				x := rnd.Intn(n)
+				// set bits over width too, they should be ignored.
+				v := uint16(rnd.Uint32())
+				r.set(x, width, v)
+				rr.set(x, v)
+				if got, want := r.get(x, width), rr.get(x); got != want {
+					t.Fatalf("register mismatch after set: width=%d n=%d x=%d want=%d got=%d", width, n, x, want, got)
+				}
+			}
+			checkRegisters(t, r, rr, n)
+		}
+	}
+}
+
+func TestRegistersMinMax(t *testing.T) {
+	// set all 1s and 0s to each register alternately, to detect writes
+	// which spill over neighbors.
+	for width := 1; width <= 16; width++ {
+		const n = 50
+		max := uint16(uint32(1)<<width - 1)
+		r := newRegisters(n, width)
+		rr := newRefRegisters(n, width)
+		for x := 0; x < n; x++ {
+			r.set(x, width, max)
+			rr.set(x, max)
+		}
+		checkRegisters(t, r, rr, n)
+		for x := 0; x < n; x += 2 {
+			r.set(x, width, 0)
+			rr.set(x, 0)
+		}
+		checkRegisters(t, r, rr, n)
+		for x := 0; x < n; x += 2 {
+			r.set(x, width, max)
+			rr.set(x, max)
+		}
+		for x := 1; x < n; x += 2 {
+			r.set(x, width, 0)
+			rr.set(x, 0)
+		}
+		checkRegisters(t, r, rr, n)
+	}
+}
+
+func TestRegistersLayout(t *testing.T) {
+	for _, tc := range []struct {
+		width int
+		vv    []uint16
+		want  []byte
+	}{
+		{1, []uint16{1, 0, 1, 1, 0, 0, 0, 1, 1}, []byte{0xb1, 0x80}},
+		{2, []uint16{3, 0, 1, 2, 1}, []byte{0xc6, 0x40}},
+		{3, []uint16{7, 0, 5, 1, 6}, []byte{0xe2, 0x9c}},
+		{4, []uint16{0xa, 0x5, 0xf}, []byte{0xa5, 0xf0}},
+		{8, []uint16{0x12, 0xff, 0x00}, []byte{0x12, 0xff, 0x00}},
+		{12, []uint16{0xabc, 0xdef}, []byte{0xab, 0xcd, 0xef}},
+		{16, []uint16{0x1234, 0xfedc}, []byte{0x12, 0x34, 0xfe, 0xdc}},
+	} {
+		r := newRegisters(len(tc.vv), tc.width)
+		for x, v := range tc.vv {
+			r.set(x, tc.width, v)
+		}
+		if !bytes.Equal(r, tc.want) {
+			t.Errorf("unexpected layout: width=%d want=%x got=%x", tc.width, tc.want, []byte(r))
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package bloomfilter
+
+import (
+	"context"
+	"fmt"
+)
+
+// StoreFactory creates a Store which has m bits for n-th slice of SBF.
+// It is called once for each slice when SBF grows, and the Store should be
+// empty.
+type StoreFactory func(n, m int) (Store, error)
+
+func newMemoryStoreFactory(_, m int) (Store, error) {
+	return NewMemoryStore(m), nil
+}
+
+const (
+	sbfDefaultGrowth = 2
+	sbfDefaultRatio  = 0.85
+)
+
+// SBF provides scalable bloom filter (Almeida et al.), which grows by adding
+// slices of BF when its capacity is exceeded.
+//
+// The n-th slice holds (capacity * growth^n) items with false positive rate
+// (fpRate * (1 - ratio) * ratio^n), so total false positive rate is kept
+// under fpRate.
+// Counts of items in slices are kept in memory, and every Put is counted
+// even when the item is already in the filter.
+// So a SBF can't be reopened nor shared by processes, even if its slices are
+// stored by WithStoreFactory: the number of slices and their counts are lost.
+type SBF struct {
+	capacity int
+	fpRate   float64
+	growth   int
+	ratio    float64
+	ix       Indexer
+	blocked  bool
+
+	newStore StoreFactory
+	slices   []*sbfSlice
+}
+
+type sbfSlice struct {
+	bf       *BF
+	capacity int
+	count    int
+}
+
+// NewSBF creates a scalable bloom filter, which holds n items with false
+// positive rate fpRate at first.
+func NewSBF(n int, fpRate float64, opts ...Option) (*SBF, error) {
+	err := checkEstimateArgs(n, fpRate)
+	if err != nil {
+		return nil, err
+	}
+	o := newOptions(opts)
+	sf := &SBF{
+		capacity: n,
+		fpRate:   fpRate,
+		growth:   sbfDefaultGrowth,
+		ratio:    sbfDefaultRatio,
+		ix:       o.indexer(),
+		blocked:  o.blocked,
+		newStore: newMemoryStoreFactory,
+	}
+	if o.growth != 0 {
+		if o.growth < 1 {
+			return nil, fmt.Errorf("growth should be >= 1: growth=%d", o.growth)
+		}
+		sf.growth = o.growth
+	}
+	if o.ratio != 0 {
+		if !(o.ratio > 0 && o.ratio < 1) {
+			return nil, fmt.Errorf("tightening ratio should be in (0, 1): ratio=%g", o.ratio)
+		}
+		sf.ratio = o.ratio
+	}
+	if o.storeFactory != nil {
+		sf.newStore = o.storeFactory
+	}
+	err = sf.grow()
+	if err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// grow adds a new slice.
+func (sf *SBF) grow() error {
+	n := len(sf.slices)
+	capacity, fpRate := sf.capacity, sf.fpRate*(1-sf.ratio)
+	for i := 0; i < n; i++ {
+		if capacity > maxInt/sf.growth {
+			return fmt.Errorf("too large capacity for slice #%d", n)
+		}
+		capacity *= sf.growth
+		fpRate *= sf.ratio
+	}
+	m, k, err := EstimateParameters(capacity, fpRate)
+	if err != nil {
+		return fmt.Errorf("failed to estimate parameters for slice #%d: %w", n, err)
+	}
+	opts := []Option{withIndexer(sf.ix)}
+	if sf.blocked {
+		m, err = blockedM(m)
+		if err != nil {
+			return fmt.Errorf("failed to estimate parameters for slice #%d: %w", n, err)
+		}
+		opts = append(opts, WithBlocked())
+	}
+	s, err := sf.newStore(n, m)
+	if err != nil {
+		return fmt.Errorf("failed to create store for slice #%d: %w", n, err)
+	}
+	sf.slices = append(sf.slices, &sbfSlice{
+		bf:       New(m, k, NewHasher(k, m, opts...), s),
+		capacity: capacity,
+	})
+	return nil
+}
+
+// Put puts a byte array to the filter.
+func (sf *SBF) Put(ctx context.Context, d []byte) error {
+	last := sf.slices[len(sf.slices)-1]
+	if last.count >= last.capacity {
+		err := sf.grow()
+		if err != nil {
+			return err
+		}
+		last = sf.slices[len(sf.slices)-1]
+	}
+	err := last.bf.Put(ctx, d)
+	if err != nil {
+		return err
+	}
+	last.count++
+	return nil
+}
+
+// PutString puts a string to the filter.
+func (sf *SBF) PutString(ctx context.Context, s string) error {
+	return sf.Put(ctx, []byte(s))
+}
+
+// Check checks that a byte array is in the filter.
+func (sf *SBF) Check(ctx context.Context, d []byte) (bool, error) {
+	for i, s := range sf.slices {
+		has, err := s.bf.Check(ctx, d)
+		if err != nil {
+			return false, fmt.Errorf("check failed at slice #%d: %w", i, err)
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// CheckString checks that a string is in the filter.
+func (sf *SBF) CheckString(ctx context.Context, s string) (bool, error) {
+	return sf.Check(ctx, []byte(s))
+}
+
+// Slices returns the number of slices.
+func (sf *SBF) Slices() int {
+	return len(sf.slices)
+}
+
+// FalsePositiveRate returns the estimated false positive rate of the filter,
+// with current number of items.
+func (sf *SBF) FalsePositiveRate() float64 {
+	r := 1.0
+	for _, s := range sf.slices {
+		r *= 1 - FalsePositiveRate(s.bf.m, s.bf.k, s.count)
+	}
+	return 1 - r
+}
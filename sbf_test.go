@@ -0,0 +1,112 @@
+package bloomfilter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func checkSBF(t *testing.T, sf *SBF, n int, fpRate float64) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		err := sf.PutString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		has, err := sf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if !has {
+			t.Fatalf("false negative: %d", i)
+		}
+	}
+	falsePositive := 0
+	for i := n; i < n*11; i++ {
+		has, err := sf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if has {
+			falsePositive++
+		}
+	}
+	errRate := float64(falsePositive) / float64(n*10)
+	if errRate > fpRate*1.5 {
+		t.Errorf("too big error rate: %.4f want<=%.4f false_positive=%d slices=%d", errRate, fpRate, falsePositive, sf.Slices())
+	}
+	if r := sf.FalsePositiveRate(); r > fpRate {
+		t.Errorf("too big estimated error rate: %.4f want<=%.4f", r, fpRate)
+	}
+}
+
+func TestSBFGrow(t *testing.T) {
+	sf, err := NewSBF(100, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := sf.Slices(); n != 1 {
+		t.Fatalf("unexpected slices at first: %d", n)
+	}
+	// capacities of slices are 100, 200, 400, 800: total 1500
+	checkSBF(t, sf, 1500, 0.01)
+	if n := sf.Slices(); n != 4 {
+		t.Errorf("unexpected slices: want=4 got=%d", n)
+	}
+}
+
+func TestSBFOptions(t *testing.T) {
+	var created []int
+	sf, err := NewSBF(100, 0.01,
+		WithGrowth(4),
+		WithTighteningRatio(0.5),
+		WithStoreFactory(func(n, m int) (Store, error) {
+			created = append(created, n)
+			return NewAtomicMemoryStore(m), nil
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// capacities of slices are 100, 400, 1600: total 2100
+	checkSBF(t, sf, 2100, 0.01)
+	if n := sf.Slices(); n != 3 || len(created) != 3 {
+		t.Errorf("unexpected slices: want=3 got=%d created=%+v", n, created)
+	}
+
+	errFactory := errors.New("factory failed")
+	sf, err = NewSBF(1, 0.01, WithStoreFactory(func(n, m int) (Store, error) {
+		if n > 0 {
+			return nil, errFactory
+		}
+		return NewMemoryStore(m), nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := sf.PutString(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.PutString(ctx, "bar"); !errors.Is(err, errFactory) {
+		t.Errorf("put should fail with factory error: %v", err)
+	}
+}
+
+func TestSBFInvalid(t *testing.T) {
+	for i, opts := range [][]Option{
+		{WithGrowth(-1)},
+		{WithTighteningRatio(1)},
+		{WithTighteningRatio(-0.5)},
+	} {
+		if _, err := NewSBF(100, 0.01, opts...); err == nil {
+			t.Errorf("should fail #%d", i)
+		}
+	}
+	if _, err := NewSBF(0, 0.01); err == nil {
+		t.Error("should fail with n=0")
+	}
+}
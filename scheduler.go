@@ -0,0 +1,192 @@
+package bloomfilter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Generational is a volatile filter which advances generations, like VBF3
+// (via SyncVBF3.Generational), VBF3Redis and vbf3redis.VBF3Redis.
+type Generational interface {
+	AdvanceGeneration(ctx context.Context, generations uint8) error
+	Sweep(ctx context.Context) error
+}
+
+// Lease is an expiring lock, which is used to make only one of processes
+// advance a shared filter.
+type Lease interface {
+	// Acquire acquires the lease or extends it for ttl. It returns false when
+	// other holds the lease.
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+	// Release releases the lease when it is held.
+	Release(ctx context.Context) error
+}
+
+// StepSweeper is a filter which can be swept incrementally, like
+// vbf3redis.VBF3Redis. Scheduler sweeps it by steps and renews the lease
+// between steps, because a sweep of a large filter may take longer than the
+// lease.
+type StepSweeper interface {
+	SweepStep(ctx context.Context, size int) (bool, error)
+}
+
+// schedulerSweepStep is number of registers which are swept by a step of
+// StepSweeper.
+const schedulerSweepStep = 64 * 1024
+
+// Scheduler advances generations of a filter periodically.
+//
+// Registers of VBF3 are values on a ring of 255 generations, so expired
+// registers come back into the valid window after advancing 255-maxLife
+// generations. Scheduler sweeps the filter before that, and when it starts
+// (or acquires the lease) because generations may have been advanced by
+// others.
+type Scheduler struct {
+	f      Generational
+	budget int
+	period time.Duration
+	lease  Lease
+
+	// advanced is number of generations which were advanced since the last
+	// sweep. Negative means unknown, then it sweeps before advancing.
+	advanced int
+	held     bool
+}
+
+// NewScheduler creates a Scheduler, which advances a generation of the filter
+// with maxLife every period. When lease is not nil, it advances only while it
+// holds the lease.
+func NewScheduler(f Generational, maxLife uint8, period time.Duration, lease Lease) (*Scheduler, error) {
+	if maxLife == 0 || maxLife == 255 {
+		return nil, fmt.Errorf("maxLife should be 1~254 for sweeps: %d", maxLife)
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("period should be positive: %s", period)
+	}
+	return &Scheduler{
+		f:      f,
+		budget: 255 - int(maxLife),
+		period: period,
+		lease:  lease,
+
+		advanced: -1,
+	}, nil
+}
+
+// Run advances generations until ctx is done, then it releases the lease.
+// It returns ctx.Err() or the first error of the filter or the lease. Run can
+// be called again after an error.
+func (s *Scheduler) Run(ctx context.Context) error {
+	defer s.release()
+	ticker := time.NewTicker(s.period)
+	defer ticker.Stop()
+	if s.lease == nil && s.advanced < 0 {
+		_, err := s.sweep(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		err := s.Step(ctx)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Step advances a generation, as a tick of Run. It sweeps the filter before
+// advancing when it is needed.
+// With a lease, it renews the lease after sweeping (and between steps of a
+// StepSweeper), and gives up advancing when the lease is lost.
+func (s *Scheduler) Step(ctx context.Context) error {
+	ok, err := s.acquire(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	if s.advanced < 0 || s.advanced+1 > s.budget {
+		ok, err := s.sweep(ctx)
+		if err != nil || !ok {
+			return err
+		}
+		// the sweep may take long, so renew the lease before advancing.
+		ok, err = s.acquire(ctx)
+		if err != nil || !ok {
+			return err
+		}
+	}
+	err = s.f.AdvanceGeneration(ctx, 1)
+	// count it even when failed, it may be advanced.
+	s.advanced++
+	if err != nil {
+		return fmt.Errorf("failed to advance generation: %w", err)
+	}
+	return nil
+}
+
+// acquire acquires or renews the lease. It returns false when others hold
+// the lease. Without a lease, it always returns true.
+func (s *Scheduler) acquire(ctx context.Context) (bool, error) {
+	if s.lease == nil {
+		return true, nil
+	}
+	ok, err := s.lease.Acquire(ctx, 2*s.period)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	if !ok {
+		s.held = false
+		return false, nil
+	}
+	if !s.held {
+		// others may have advanced generations.
+		s.held = true
+		s.advanced = -1
+	}
+	return true, nil
+}
+
+// sweep sweeps the filter. It returns false when the lease is lost while
+// sweeping a StepSweeper, then the sweep is left to the holder of the lease.
+func (s *Scheduler) sweep(ctx context.Context) (bool, error) {
+	ss, ok := s.f.(StepSweeper)
+	if !ok || s.lease == nil {
+		err := s.f.Sweep(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to sweep: %w", err)
+		}
+		s.advanced = 0
+		return true, nil
+	}
+	for {
+		done, err := ss.SweepStep(ctx, schedulerSweepStep)
+		if err != nil {
+			return false, fmt.Errorf("failed to sweep: %w", err)
+		}
+		if done {
+			break
+		}
+		ok, err := s.acquire(ctx)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	s.advanced = 0
+	return true, nil
+}
+
+func (s *Scheduler) release() {
+	if s.lease == nil || !s.held {
+		return
+	}
+	s.held = false
+	// ctx of Run may be done already.
+	ctx, cancel := context.WithTimeout(context.Background(), s.period)
+	defer cancel()
+	s.lease.Release(ctx)
+}
@@ -0,0 +1,255 @@
+package bloomfilter
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordGenerational records calls as "a" (advance) and "s" (sweep).
+type recordGenerational struct {
+	calls []string
+	err   error
+}
+
+func (rg *recordGenerational) AdvanceGeneration(_ context.Context, generations uint8) error {
+	rg.calls = append(rg.calls, strings.Repeat("a", int(generations)))
+	return rg.err
+}
+
+func (rg *recordGenerational) Sweep(_ context.Context) error {
+	rg.calls = append(rg.calls, "s")
+	return rg.err
+}
+
+func (rg *recordGenerational) pop() string {
+	s := strings.Join(rg.calls, "")
+	rg.calls = nil
+	return s
+}
+
+// fakeLease is a Lease which is held while ok is true.
+type fakeLease struct {
+	ok       bool
+	released bool
+}
+
+func (fl *fakeLease) Acquire(context.Context, time.Duration) (bool, error) {
+	return fl.ok, nil
+}
+
+func (fl *fakeLease) Release(context.Context) error {
+	fl.released = true
+	return nil
+}
+
+func TestNewSchedulerInvalid(t *testing.T) {
+	rg := &recordGenerational{}
+	for _, maxLife := range []uint8{0, 255} {
+		_, err := NewScheduler(rg, maxLife, time.Second, nil)
+		if err == nil {
+			t.Errorf("maxLife=%d should fail", maxLife)
+		}
+	}
+	_, err := NewScheduler(rg, 10, 0, nil)
+	if err == nil {
+		t.Error("zero period should fail")
+	}
+}
+
+func TestSchedulerStep(t *testing.T) {
+	ctx := context.Background()
+	rg := &recordGenerational{}
+	// budget is 255-250 = 5 generations between sweeps.
+	s, err := NewScheduler(rg, 250, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 12; i++ {
+		err := s.Step(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := rg.pop(), "saaaaasaaaaasaa"; got != want {
+		t.Errorf("unexpected calls: want=%s got=%s", want, got)
+	}
+}
+
+func TestSchedulerStepError(t *testing.T) {
+	ctx := context.Background()
+	rg := &recordGenerational{err: errors.New("failure")}
+	s, err := NewScheduler(rg, 250, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Step(ctx); err == nil {
+		t.Fatal("step should fail")
+	}
+	rg.err = nil
+	// sweep failed, so it sweeps again.
+	if err := s.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rg.pop(), "ssa"; got != want {
+		t.Errorf("unexpected calls: want=%s got=%s", want, got)
+	}
+}
+
+func TestSchedulerLease(t *testing.T) {
+	ctx := context.Background()
+	rg := &recordGenerational{}
+	fl := &fakeLease{}
+	s, err := NewScheduler(rg, 10, time.Second, fl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := func(ok bool, want string) {
+		t.Helper()
+		fl.ok = ok
+		err := s.Step(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rg.pop(); got != want {
+			t.Errorf("unexpected calls: want=%q got=%q", want, got)
+		}
+	}
+	step(false, "")
+	step(true, "sa")
+	step(true, "a")
+	step(false, "")
+	// others may have advanced while the lease was lost.
+	step(true, "sa")
+	step(true, "a")
+}
+
+// stepGenerational is a recordGenerational which is swept by steps, records
+// them as "t".
+type stepGenerational struct {
+	recordGenerational
+	steps int
+	pos   int
+}
+
+func (sg *stepGenerational) SweepStep(_ context.Context, _ int) (bool, error) {
+	sg.calls = append(sg.calls, "t")
+	sg.pos++
+	if sg.pos < sg.steps {
+		return false, nil
+	}
+	sg.pos = 0
+	return true, nil
+}
+
+// countLease is a Lease which is held for first n acquisitions.
+type countLease struct {
+	n int
+}
+
+func (cl *countLease) Acquire(context.Context, time.Duration) (bool, error) {
+	if cl.n <= 0 {
+		return false, nil
+	}
+	cl.n--
+	return true, nil
+}
+
+func (cl *countLease) Release(context.Context) error {
+	return nil
+}
+
+func TestSchedulerLeaseSweepStep(t *testing.T) {
+	ctx := context.Background()
+	sg := &stepGenerational{steps: 5}
+	cl := &countLease{n: 3}
+	s, err := NewScheduler(sg, 10, time.Second, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lease is lost while sweeping, so it doesn't advance.
+	if err := s.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sg.pop(), "ttt"; got != want {
+		t.Errorf("unexpected calls: want=%q got=%q", want, got)
+	}
+	// the sweep is resumed after the lease is acquired again.
+	cl.n = 100
+	if err := s.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sg.pop(), "tta"; got != want {
+		t.Errorf("unexpected calls: want=%q got=%q", want, got)
+	}
+	if err := s.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sg.pop(), "a"; got != want {
+		t.Errorf("unexpected calls: want=%q got=%q", want, got)
+	}
+	// without a lease, it sweeps by Sweep.
+	s2, err := NewScheduler(sg, 10, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sg.pop(), "sa"; got != want {
+		t.Errorf("unexpected calls: want=%q got=%q", want, got)
+	}
+}
+
+func TestSchedulerRun(t *testing.T) {
+	f := NewSyncVBF3(NewVBF3(1000, 7, 2))
+	fl := &fakeLease{ok: true}
+	s, err := NewScheduler(f.Generational(), 2, time.Millisecond, fl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Put([]byte("foo"), 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = s.Run(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("run should stop with context: %v", err)
+	}
+	if !fl.released {
+		t.Error("lease is not released")
+	}
+	if f.Check([]byte("foo")) {
+		t.Error("foo should be expired")
+	}
+}
+
+func TestSchedulerNoResurrection(t *testing.T) {
+	ctx := context.Background()
+	f := NewSyncVBF3(NewVBF3(1000, 7, 10))
+	s, err := NewScheduler(f.Generational(), 10, time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Put([]byte("foo"), 1)
+	for i := 1; i <= 600; i++ {
+		err := s.Step(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// check a copy, because Check clears expired registers.
+		b, err := f.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c VBF3
+		err = c.UnmarshalBinary(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Check([]byte("foo")) {
+			t.Fatalf("foo is resurrected after %d generations", i)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package bloomfilter
 
 import (
 	"context"
+	"sync/atomic"
 )
 
 // Store defines bits store for bloom filter (BF).
@@ -12,6 +13,28 @@ type Store interface {
 	CheckBits(ctx context.Context, indexes ...int) (bool, error)
 }
 
+// BatchStore is an optional interface of Store, which sets or checks bits for
+// multiple items at once. It is used by BF.PutAll and BF.CheckAll to reduce
+// round-trips to remote stores.
+type BatchStore interface {
+	Store
+	// SetBitsAll sets bits on all groups of indexes in the store.
+	SetBitsAll(ctx context.Context, indexes [][]int) error
+	// CheckBitsAll checks all bits are `true` for each group of indexes in
+	// the store.
+	CheckBitsAll(ctx context.Context, indexes [][]int) ([]bool, error)
+}
+
+// CheckAndSetStore is an optional interface of Store, which checks and sets
+// bits at once. It is used by BF.CheckAndPut to be atomic and to reduce
+// round-trips to remote stores.
+type CheckAndSetStore interface {
+	Store
+	// CheckAndSetBits sets bits on indexes in the store, and returns true
+	// when all bits were `true` before.
+	CheckAndSetBits(ctx context.Context, indexes ...int) (bool, error)
+}
+
 // MemoryStore provides Store interface with memory.
 type MemoryStore []byte
 
@@ -42,3 +65,83 @@ func (ms MemoryStore) CheckBits(_ context.Context, indexes ...int) (bool, error)
 	}
 	return true, nil
 }
+
+// CheckAndSetBits sets bits on indexes in the store, and returns true when
+// all bits were `true` before.
+func (ms MemoryStore) CheckAndSetBits(_ context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	retval := true
+	for _, x := range indexes {
+		b := byte(1) << (x % 8)
+		if ms[x/8]&b == 0 {
+			retval = false
+			ms[x/8] |= b
+		}
+	}
+	return retval, nil
+}
+
+// AtomicMemoryStore provides Store interface with memory, which is safe for
+// concurrent use without locks.
+type AtomicMemoryStore []uint64
+
+// NewAtomicMemoryStore creates an atomic memory store for bloom filter.
+func NewAtomicMemoryStore(nbits int) AtomicMemoryStore {
+	nwords := (nbits + 63) / 64
+	return AtomicMemoryStore(make([]uint64, nwords))
+}
+
+// SetBits sets bits on indexes in the store.
+func (as AtomicMemoryStore) SetBits(_ context.Context, indexes ...int) error {
+	for _, x := range indexes {
+		p := &as[x/64]
+		b := uint64(1) << (x % 64)
+		for {
+			v := atomic.LoadUint64(p)
+			if v&b != 0 || atomic.CompareAndSwapUint64(p, v, v|b) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// CheckBits checks all bits are `true` on indexes in the store.
+func (as AtomicMemoryStore) CheckBits(_ context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	for _, x := range indexes {
+		if atomic.LoadUint64(&as[x/64])&(1<<(x%64)) == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CheckAndSetBits sets bits on indexes in the store, and returns true when
+// all bits were `true` before.
+// When concurrent calls set same indexes, at least one of them returns false.
+func (as AtomicMemoryStore) CheckAndSetBits(_ context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	retval := true
+	for _, x := range indexes {
+		p := &as[x/64]
+		b := uint64(1) << (x % 64)
+		for {
+			v := atomic.LoadUint64(p)
+			if v&b != 0 {
+				break
+			}
+			if atomic.CompareAndSwapUint64(p, v, v|b) {
+				retval = false
+				break
+			}
+		}
+	}
+	return retval, nil
+}
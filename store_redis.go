@@ -0,0 +1,179 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redisPageBits is the number of bits which is stored in a Redis key.
+// Redis limits size of a string value up to 512MB.
+const redisPageBits uint64 = 512 * 1024 * 1024 * 8
+
+// RedisStore provides Store interface with Redis.
+// Bits are stored in keys name_0, name_1, ... of 512MB each, like vbf3redis
+// without WithHashTag. So pages may be in different slots on Redis Cluster.
+// It implements BatchStore and CheckAndSetStore too.
+type RedisStore struct {
+	c       redis.UniversalClient
+	name    string
+	pageNum int
+}
+
+// NewRedisStore creates a Redis store for bloom filter, which has nbits.
+func NewRedisStore(uc redis.UniversalClient, name string, nbits int) *RedisStore {
+	return &RedisStore{
+		c:       uc,
+		name:    name,
+		pageNum: int((uint64(nbits) + redisPageBits - 1) / redisPageBits),
+	}
+}
+
+func (rs *RedisStore) key(page uint64) string {
+	return rs.name + "_" + strconv.FormatUint(page, 10)
+}
+
+type redisStorePage struct {
+	args []interface{}
+	pos  []int
+}
+
+// bitfield runs "BITFIELD {op} u1 ..." for indexes on all pages in a
+// round-trip, and returns values in the order of indexes.
+func (rs *RedisStore) bitfield(ctx context.Context, op string, indexes []int) ([]int64, error) {
+	pages := map[uint64]*redisStorePage{}
+	order := make([]uint64, 0, 1)
+	for i, x := range indexes {
+		n := uint64(x) / redisPageBits
+		p, ok := pages[n]
+		if !ok {
+			p = &redisStorePage{}
+			pages[n] = p
+			order = append(order, n)
+		}
+		p.args = append(p.args, op, "u1", uint64(x)%redisPageBits)
+		if op == "SET" {
+			p.args = append(p.args, 1)
+		}
+		p.pos = append(p.pos, i)
+	}
+	cmds := make([]*redis.IntSliceCmd, len(order))
+	_, err := rs.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, n := range order {
+			cmds[i] = pipe.BitField(ctx, rs.key(n), pages[n].args...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]int64, len(indexes))
+	for i, n := range order {
+		pos := pages[n].pos
+		for j, v := range cmds[i].Val() {
+			vals[pos[j]] = v
+		}
+	}
+	return vals, nil
+}
+
+// SetBits sets bits on indexes in the store.
+func (rs *RedisStore) SetBits(ctx context.Context, indexes ...int) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	_, err := rs.bitfield(ctx, "SET", indexes)
+	return err
+}
+
+// CheckBits checks all bits are `true` on indexes in the store.
+func (rs *RedisStore) CheckBits(ctx context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	vals, err := rs.bitfield(ctx, "GET", indexes)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range vals {
+		if v == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// CheckAndSetBits sets bits on indexes in the store, and returns true when
+// all bits were `true` before. "BITFIELD SET" returns old values, so it is
+// done by a command for each page.
+func (rs *RedisStore) CheckAndSetBits(ctx context.Context, indexes ...int) (bool, error) {
+	if len(indexes) == 0 {
+		return false, nil
+	}
+	vals, err := rs.bitfield(ctx, "SET", indexes)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range vals {
+		if v == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func flattenIndexes(indexes [][]int) []int {
+	n := 0
+	for _, x := range indexes {
+		n += len(x)
+	}
+	flat := make([]int, 0, n)
+	for _, x := range indexes {
+		flat = append(flat, x...)
+	}
+	return flat
+}
+
+// SetBitsAll sets bits on all groups of indexes in the store.
+func (rs *RedisStore) SetBitsAll(ctx context.Context, indexes [][]int) error {
+	return rs.SetBits(ctx, flattenIndexes(indexes)...)
+}
+
+// CheckBitsAll checks all bits are `true` for each group of indexes in the
+// store.
+func (rs *RedisStore) CheckBitsAll(ctx context.Context, indexes [][]int) ([]bool, error) {
+	flat := flattenIndexes(indexes)
+	if len(flat) == 0 {
+		return make([]bool, len(indexes)), nil
+	}
+	vals, err := rs.bitfield(ctx, "GET", flat)
+	if err != nil {
+		return nil, err
+	}
+	rr := make([]bool, len(indexes))
+	base := 0
+	for i, x := range indexes {
+		r := len(x) > 0
+		for _, v := range vals[base : base+len(x)] {
+			if v == 0 {
+				r = false
+				break
+			}
+		}
+		rr[i] = r
+		base += len(x)
+	}
+	return rr, nil
+}
+
+// Drop deletes all keys of the store from Redis.
+func (rs *RedisStore) Drop(ctx context.Context) error {
+	_, err := rs.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < rs.pageNum; i++ {
+			pipe.Del(ctx, rs.key(uint64(i)))
+		}
+		return nil
+	})
+	return err
+}
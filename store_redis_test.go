@@ -0,0 +1,80 @@
+package bloomfilter
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func newTestRedisStore(t *testing.T, nbits int) *RedisStore {
+	t.Helper()
+	c := newTestRedisClient(t)
+	rs := NewRedisStore(c, t.Name(), nbits)
+	t.Cleanup(func() {
+		rs.Drop(context.Background())
+	})
+	return rs
+}
+
+func TestRedisStore(t *testing.T) {
+	if strconv.IntSize < 64 {
+		t.Skip("indexes over a page need 64 bits int")
+	}
+	var pageBits = redisPageBits
+	page := int(pageBits)
+	rs := newTestRedisStore(t, page*2)
+	ctx := context.Background()
+	err := rs.SetBits(ctx, 0, 1, 2, 3, 8, page+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkStoreTrue(ctx, t, rs, 0, 1, 2, 3)
+	checkStoreTrue(ctx, t, rs, 8)
+	checkStoreTrue(ctx, t, rs, 0, page+5)
+
+	checkStoreFalse(ctx, t, rs)
+	checkStoreFalse(ctx, t, rs, 4)
+	checkStoreFalse(ctx, t, rs, 5)
+	checkStoreFalse(ctx, t, rs, 0, 1, 2, 3, 4)
+	checkStoreFalse(ctx, t, rs, page+4)
+	checkStoreFalse(ctx, t, rs, 8, page+6)
+
+	n, err := rs.c.Exists(ctx, rs.key(1)).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("second page should exist")
+	}
+}
+
+func TestRedisStoreBF(t *testing.T) {
+	checkBFAll(t, New(2000, 7, nil, newTestRedisStore(t, 2000)))
+}
+
+func TestRedisStoreCheckAndSet(t *testing.T) {
+	rs := newTestRedisStore(t, 1000)
+	checkStoreCheckAndSet(context.Background(), t, rs)
+}
+
+func TestRedisStorePageNum(t *testing.T) {
+	for _, tc := range []struct {
+		nbits uint64
+		want  int
+	}{
+		{1, 1},
+		{1000, 1},
+		{redisPageBits, 1},
+		{redisPageBits + 1, 2},
+		{redisPageBits * 2, 2},
+	} {
+		if tc.nbits > uint64(maxInt) {
+			continue
+		}
+		rs := NewRedisStore(nil, t.Name(), int(tc.nbits))
+		if rs.pageNum != tc.want {
+			t.Errorf("unexpected pageNum for %d bits: want=%d got=%d", tc.nbits, tc.want, rs.pageNum)
+		}
+	}
+}
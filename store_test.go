@@ -2,6 +2,9 @@ package bloomfilter
 
 import (
 	"context"
+	"math/rand"
+	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -53,3 +56,148 @@ func TestMemoryStore(t *testing.T) {
 	checkStoreTrue(ctx, t, ms, 12)
 	checkStoreTrue(ctx, t, ms, 15)
 }
+
+func TestAtomicMemoryStore(t *testing.T) {
+	as := NewAtomicMemoryStore(128)
+	ctx := context.Background()
+	err := as.SetBits(ctx, 0, 1, 2, 3, 8, 63, 64, 127)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkStoreTrue(ctx, t, as, 0, 1, 2, 3)
+	checkStoreTrue(ctx, t, as, 8)
+	checkStoreTrue(ctx, t, as, 63, 64)
+	checkStoreTrue(ctx, t, as, 127)
+
+	checkStoreFalse(ctx, t, as)
+	checkStoreFalse(ctx, t, as, 4)
+	checkStoreFalse(ctx, t, as, 62)
+	checkStoreFalse(ctx, t, as, 65)
+	checkStoreFalse(ctx, t, as, 0, 1, 2, 3, 4)
+}
+
+func TestAtomicMemoryStoreConcurrent(t *testing.T) {
+	const m, k, n = 10000, 7, 1000
+	bf := New(m, k, nil, NewAtomicMemoryStore(m))
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := i; j < n; j += 8 {
+				err := bf.PutString(ctx, strconv.Itoa(j))
+				if err != nil {
+					t.Errorf("put failed: %s", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < n; i++ {
+		has, err := bf.CheckString(ctx, strconv.Itoa(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !has {
+			t.Errorf("false negative: %d", i)
+		}
+	}
+}
+
+func benchmarkStoreSetBits(b *testing.B, s Store, nbits int) {
+	b.Helper()
+	ctx := context.Background()
+	indexes := make([]int, 7)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range indexes {
+			indexes[j] = rand.Intn(nbits)
+		}
+		s.SetBits(ctx, indexes...)
+	}
+}
+
+func BenchmarkMemoryStore_SetBits(b *testing.B) {
+	benchmarkStoreSetBits(b, NewMemoryStore(1<<20), 1<<20)
+}
+
+func BenchmarkAtomicMemoryStore_SetBits(b *testing.B) {
+	benchmarkStoreSetBits(b, NewAtomicMemoryStore(1<<20), 1<<20)
+}
+
+func benchmarkStoreCheckBits(b *testing.B, s Store, nbits int) {
+	b.Helper()
+	ctx := context.Background()
+	for i := 0; i < nbits/8; i++ {
+		s.SetBits(ctx, rand.Intn(nbits))
+	}
+	indexes := make([]int, 7)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range indexes {
+			indexes[j] = rand.Intn(nbits)
+		}
+		s.CheckBits(ctx, indexes...)
+	}
+}
+
+func BenchmarkMemoryStore_CheckBits(b *testing.B) {
+	benchmarkStoreCheckBits(b, NewMemoryStore(1<<20), 1<<20)
+}
+
+func BenchmarkAtomicMemoryStore_CheckBits(b *testing.B) {
+	benchmarkStoreCheckBits(b, NewAtomicMemoryStore(1<<20), 1<<20)
+}
+
+// BenchmarkAtomicMemoryStore_ParallelPut measures BF.Put shared by multiple
+// goroutines. MemoryStore can't be used for this without a lock.
+func BenchmarkAtomicMemoryStore_ParallelPut(b *testing.B) {
+	const m = 1 << 20
+	bf := New(m, 7, nil, NewAtomicMemoryStore(m))
+	ctx := context.Background()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			bf.PutString(ctx, strconv.Itoa(i))
+			i++
+		}
+	})
+}
+
+func checkStoreCheckAndSet(ctx context.Context, t *testing.T, s CheckAndSetStore) {
+	t.Helper()
+	for i, tc := range []struct {
+		indexes []int
+		want    bool
+	}{
+		{nil, false},
+		{[]int{0, 1, 2}, false},
+		{[]int{0, 1, 2}, true},
+		{[]int{2, 3}, false},
+		{[]int{0, 1, 2, 3}, true},
+		{[]int{100}, false},
+		{[]int{1, 100}, true},
+	} {
+		got, err := s.CheckAndSetBits(ctx, tc.indexes...)
+		if err != nil {
+			t.Fatalf("#%d CheckAndSetBits failed: %s", i, err)
+		}
+		if got != tc.want {
+			t.Errorf("#%d unexpected CheckAndSetBits(%v): want=%t got=%t", i, tc.indexes, tc.want, got)
+		}
+	}
+	checkStoreTrue(ctx, t, s, 0, 1, 2, 3, 100)
+	checkStoreFalse(ctx, t, s, 4)
+}
+
+func TestMemoryStoreCheckAndSet(t *testing.T) {
+	checkStoreCheckAndSet(context.Background(), t, NewMemoryStore(1000))
+}
+
+func TestAtomicMemoryStoreCheckAndSet(t *testing.T) {
+	checkStoreCheckAndSet(context.Background(), t, NewAtomicMemoryStore(1000))
+}
@@ -0,0 +1,176 @@
+package bloomfilter
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// SyncVBF is a VBF which is safe for concurrent use.
+type SyncVBF struct {
+	mu sync.RWMutex
+	f  *VBF
+}
+
+// NewSyncVBF wraps a VBF to be safe for concurrent use.
+// The VBF should not be used directly after wrapped.
+func NewSyncVBF(f *VBF) *SyncVBF {
+	return &SyncVBF{f: f}
+}
+
+// Put puts a byte array to the filter.
+func (sf *SyncVBF) Put(d []byte) {
+	sf.mu.Lock()
+	sf.f.Put(d)
+	sf.mu.Unlock()
+}
+
+// Check checks that a byte array is in the filter.
+func (sf *SyncVBF) Check(d []byte, margin uint8) bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.f.Check(d, margin)
+}
+
+// SetCurr updates the current generation.
+func (sf *SyncVBF) SetCurr(curr uint8) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.SetCurr(curr)
+}
+
+// Curr returns the current generation.
+func (sf *SyncVBF) Curr() uint8 {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.f.Curr()
+}
+
+// Max returns the max generation.
+func (sf *SyncVBF) Max() uint8 {
+	return sf.f.Max()
+}
+
+// SyncVBF2 is a VBF2 which is safe for concurrent use.
+type SyncVBF2 struct {
+	mu sync.RWMutex
+	f  *VBF2
+}
+
+// NewSyncVBF2 wraps a VBF2 to be safe for concurrent use.
+// The VBF2 should not be used directly after wrapped.
+func NewSyncVBF2(f *VBF2) *SyncVBF2 {
+	return &SyncVBF2{f: f}
+}
+
+// Put puts a byte array to the filter.
+func (sf *SyncVBF2) Put(d []byte) {
+	sf.mu.Lock()
+	sf.f.Put(d)
+	sf.mu.Unlock()
+}
+
+// Check checks that a byte array is in the filter.
+// Multiple Checks run concurrently.
+func (sf *SyncVBF2) Check(d []byte, bias uint8) bool {
+	sf.mu.RLock()
+	defer sf.mu.RUnlock()
+	return sf.f.Check(d, bias)
+}
+
+// Subtract subtracts delta from lives of all data.
+// It blocks Put and Check until all lives are updated, so they never observe
+// partially subtracted lives.
+func (sf *SyncVBF2) Subtract(delta uint8) {
+	sf.mu.Lock()
+	sf.f.Subtract(delta)
+	sf.mu.Unlock()
+}
+
+// SyncVBF3 is a VBF3 which is safe for concurrent use.
+//
+// All operations are serialized, because VBF3.Check also modifies the filter
+// (clears expired registers).
+// Put and Check observe the generation either before or after
+// AdvanceGeneration, never in between.
+// Sweep blocks Put and Check until all registers are cleaned up.
+type SyncVBF3 struct {
+	mu sync.Mutex
+	f  *VBF3
+}
+
+// NewSyncVBF3 wraps a VBF3 to be safe for concurrent use.
+// The VBF3 should not be used directly after wrapped.
+func NewSyncVBF3(f *VBF3) *SyncVBF3 {
+	return &SyncVBF3{f: f}
+}
+
+// Put puts a data with life (number of generations until expire)
+func (sf *SyncVBF3) Put(d []byte, life uint8) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.f.Put(d, life)
+}
+
+// Check checks a data is available or not.
+func (sf *SyncVBF3) Check(d []byte) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.Check(d)
+}
+
+// CheckAndPut checks a data is available or not, and puts it with life
+// atomically. It returns true when the data was available before.
+func (sf *SyncVBF3) CheckAndPut(d []byte, life uint8) bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.CheckAndPut(d, life)
+}
+
+// AdvanceGeneration advances generation.
+// See VBF3.AdvanceGeneration for sweeps and errors.
+func (sf *SyncVBF3) AdvanceGeneration(generations uint8) error {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.AdvanceGeneration(generations)
+}
+
+// Sweep cleans up all expired data slots, fill by zeros.
+func (sf *SyncVBF3) Sweep() {
+	sf.mu.Lock()
+	sf.f.Sweep()
+	sf.mu.Unlock()
+}
+
+// WriteTo writes a consistent snapshot of the filter to w.
+func (sf *SyncVBF3) WriteTo(w io.Writer) (int64, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.WriteTo(w)
+}
+
+// MarshalBinary encodes a consistent snapshot of the filter into binary form.
+func (sf *SyncVBF3) MarshalBinary() ([]byte, error) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.f.MarshalBinary()
+}
+
+// Generational returns the filter as Generational, to be advanced by
+// Scheduler.
+func (sf *SyncVBF3) Generational() Generational {
+	return syncVBF3Generational{sf: sf}
+}
+
+type syncVBF3Generational struct {
+	sf *SyncVBF3
+}
+
+func (g syncVBF3Generational) AdvanceGeneration(_ context.Context, generations uint8) error {
+	return g.sf.AdvanceGeneration(generations)
+}
+
+func (g syncVBF3Generational) Sweep(_ context.Context) error {
+	g.sf.Sweep()
+	return nil
+}
@@ -0,0 +1,126 @@
+package bloomfilter
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Run these tests with `go test -race` to detect data races.
+
+func TestSyncVBF(t *testing.T) {
+	vf, err := NewVBF(10000, 7, 15)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := NewSyncVBF(vf)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				d := []byte(strconv.Itoa(i*1000 + j))
+				sf.Put(d)
+				if !sf.Check(d, 0) {
+					t.Errorf("false negative: i=%d j=%d", i, j)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			sf.SetCurr(sf.Curr())
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSyncVBF2(t *testing.T) {
+	sf := NewSyncVBF2(NewVBF2(10000, 7, 8))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				d := []byte(strconv.Itoa(i*1000 + j))
+				sf.Put(d)
+				// at most 8 subtractions (2 per goroutine) run in total.
+				if !sf.Check(d, 255-8-1) {
+					t.Errorf("false negative: i=%d j=%d", i, j)
+					return
+				}
+				if j%100 == 0 {
+					sf.Subtract(1)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSyncVBF3(t *testing.T) {
+	sf := NewSyncVBF3(NewVBF3(10000, 7, 64))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				d := []byte(strconv.Itoa(i*1000 + j))
+				sf.Put(d, 64)
+				if !sf.Check(d) {
+					t.Errorf("false negative: i=%d j=%d", i, j)
+					return
+				}
+			}
+		}(i)
+	}
+	// advance generations and sweep concurrently, but not exhaust lives of
+	// data (64) while the test.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 32; i++ {
+			if err := sf.AdvanceGeneration(1); err != nil {
+				t.Errorf("advance failed: %s", err)
+				return
+			}
+			sf.Sweep()
+			if _, err := sf.MarshalBinary(); err != nil {
+				t.Errorf("marshal failed: %s", err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSyncVBF3CheckAndPut(t *testing.T) {
+	sf := NewSyncVBF3(NewVBF3(10000, 7, 64))
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firsts int
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if !sf.CheckAndPut([]byte(strconv.Itoa(j)), 64) {
+					mu.Lock()
+					firsts++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// each data is seen as new only once, except false positives.
+	if firsts > 200 || firsts < 190 {
+		t.Errorf("unexpected number of new data: %d", firsts)
+	}
+}
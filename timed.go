@@ -0,0 +1,178 @@
+package bloomfilter
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock provides current time. It is replaceable for tests with WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// TimedVBF3 is a VBF3 which expires data by wall-clock time.
+//
+// A generation lasts a duration, and generations are advanced by the clock
+// when the filter is used (or by Advance). So callers don't need to advance
+// generations by themselves.
+// It is safe for concurrent use.
+type TimedVBF3 struct {
+	mu       sync.Mutex
+	f        *VBF3
+	clock    Clock
+	duration time.Duration
+	maxLife  uint8
+
+	// epoch is when the current generation started.
+	epoch time.Time
+}
+
+// NewTimedVBF3 creates a TimedVBF3, which keeps data up to maxLife
+// generations of duration.
+// The current generation has been passed partially when data are put, so the
+// filter has one more generation internally to keep data for maxLife*duration
+// always. Thus maxLife should be 1~253.
+// The clock can be specified with WithClock, default is the system clock.
+func NewTimedVBF3(m, k int, maxLife uint8, duration time.Duration, opts ...Option) (*TimedVBF3, error) {
+	if maxLife == 0 || maxLife >= 254 {
+		return nil, fmt.Errorf("maxLife should be 1~253 for sweeps: %d", maxLife)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration should be positive: %s", duration)
+	}
+	clock := newOptions(opts).clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &TimedVBF3{
+		f:        NewVBF3(m, k, maxLife+1, opts...),
+		clock:    clock,
+		duration: duration,
+		maxLife:  maxLife,
+		epoch:    clock.Now(),
+	}, nil
+}
+
+// MaxTTL returns maxLife*duration, the longest TTL which is accepted by
+// PutWithTTL at any time.
+func (tf *TimedVBF3) MaxTTL() time.Duration {
+	max := time.Duration(tf.maxLife)
+	if tf.duration > math.MaxInt64/max {
+		return math.MaxInt64
+	}
+	return tf.duration * max
+}
+
+// advance advances generations which have passed since the epoch.
+func (tf *TimedVBF3) advance(now time.Time) {
+	n := now.Sub(tf.epoch) / tf.duration
+	if n <= 0 {
+		return
+	}
+	tf.epoch = tf.epoch.Add(n * tf.duration)
+	// all data are expired after maxLife generations.
+	if n > time.Duration(tf.f.max) {
+		n = time.Duration(tf.f.max)
+	}
+	// it never fails because maxLife is less than 255.
+	_ = tf.f.AdvanceGeneration(uint8(n))
+}
+
+// life returns number of generations which keep data for ttl from now.
+func (tf *TimedVBF3) life(ttl time.Duration, now time.Time) (uint8, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("ttl should be positive: %s", ttl)
+	}
+	if ttl > tf.MaxTTL() {
+		return 0, fmt.Errorf("ttl should be less than (<=) %s: %s", tf.MaxTTL(), ttl)
+	}
+	// the current generation has been passed partially, and data expire at
+	// the end of a generation. so round up the TTL from the epoch.
+	d := now.Sub(tf.epoch) + ttl
+	n := d / tf.duration
+	if d%tf.duration != 0 {
+		n++
+	}
+	if n < 1 {
+		// the clock went back.
+		n = 1
+	}
+	// it never exceeds the max life of f, which has an extra generation for
+	// the current one.
+	return uint8(n), nil
+}
+
+// Life returns number of generations which keep data for ttl at least, from
+// now. The ttl is rounded up to the end of a generation, so data may be kept
+// longer than ttl up to a duration.
+// It fails when ttl is not positive or longer than MaxTTL.
+func (tf *TimedVBF3) Life(ttl time.Duration) (uint8, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	now := tf.clock.Now()
+	tf.advance(now)
+	return tf.life(ttl, now)
+}
+
+// PutWithTTL puts a data which expires after ttl. See Life for rounding of
+// ttl and errors.
+func (tf *TimedVBF3) PutWithTTL(d []byte, ttl time.Duration) error {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	now := tf.clock.Now()
+	tf.advance(now)
+	life, err := tf.life(ttl, now)
+	if err != nil {
+		return err
+	}
+	tf.f.Put(d, life)
+	return nil
+}
+
+// CheckAndPutWithTTL checks a data is available or not, and puts it which
+// expires after ttl atomically. It returns true when the data was available
+// before. When ttl is invalid, it returns an error without checking.
+func (tf *TimedVBF3) CheckAndPutWithTTL(d []byte, ttl time.Duration) (bool, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	now := tf.clock.Now()
+	tf.advance(now)
+	life, err := tf.life(ttl, now)
+	if err != nil {
+		return false, err
+	}
+	return tf.f.CheckAndPut(d, life), nil
+}
+
+// Check checks a data is available or not.
+func (tf *TimedVBF3) Check(d []byte) bool {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	tf.advance(tf.clock.Now())
+	return tf.f.Check(d)
+}
+
+// Advance advances generations to the clock. Operations of the filter
+// advance generations also, so it is needed only to expire data (and to
+// sweep registers) before next operations.
+func (tf *TimedVBF3) Advance() {
+	tf.mu.Lock()
+	tf.advance(tf.clock.Now())
+	tf.mu.Unlock()
+}
+
+// Sweep cleans up all expired data slots, fill by zeros.
+func (tf *TimedVBF3) Sweep() {
+	tf.mu.Lock()
+	tf.advance(tf.clock.Now())
+	tf.f.Sweep()
+	tf.mu.Unlock()
+}
@@ -0,0 +1,192 @@
+package bloomfilter
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestTimedVBF3(t *testing.T, maxLife uint8) (*TimedVBF3, *fakeClock) {
+	t.Helper()
+	c := &fakeClock{now: time.Date(2021, 11, 18, 0, 0, 0, 0, time.UTC)}
+	tf, err := NewTimedVBF3(1000, 7, maxLife, time.Minute, WithClock(c))
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	return tf, c
+}
+
+func checkTimedVBF3(t *testing.T, tf *TimedVBF3, d string, want bool) {
+	t.Helper()
+	if got := tf.Check([]byte(d)); got != want {
+		t.Errorf("unexpected check for %q: want=%t got=%t", d, want, got)
+	}
+}
+
+func TestTimedVBF3Life(t *testing.T) {
+	tf, c := newTestTimedVBF3(t, 10)
+	for _, tc := range []struct {
+		elapsed time.Duration
+		ttl     time.Duration
+		want    uint8
+	}{
+		{0, time.Second, 1},
+		{0, time.Minute, 1},
+		{0, time.Minute + 1, 2},
+		{0, 10 * time.Minute, 10},
+		{30 * time.Second, 30 * time.Second, 1},
+		{30 * time.Second, 31 * time.Second, 2},
+		{59 * time.Second, 9 * time.Minute, 10},
+		// MaxTTL is accepted after the current generation has been passed.
+		{time.Second, 10 * time.Minute, 11},
+		{59 * time.Second, 10 * time.Minute, 11},
+	} {
+		c.now = tf.epoch.Add(tc.elapsed)
+		got, err := tf.Life(tc.ttl)
+		if err != nil {
+			t.Errorf("life failed: elapsed=%s ttl=%s: %s", tc.elapsed, tc.ttl, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("unexpected life: elapsed=%s ttl=%s: want=%d got=%d", tc.elapsed, tc.ttl, tc.want, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		elapsed time.Duration
+		ttl     time.Duration
+	}{
+		{0, 0},
+		{0, -time.Second},
+		{0, 10*time.Minute + 1},
+		{59 * time.Second, 10*time.Minute + 1},
+	} {
+		c.now = tf.epoch.Add(tc.elapsed)
+		_, err := tf.Life(tc.ttl)
+		if err == nil {
+			t.Errorf("life should fail: elapsed=%s ttl=%s", tc.elapsed, tc.ttl)
+		}
+	}
+	if got := tf.MaxTTL(); got != 10*time.Minute {
+		t.Errorf("unexpected MaxTTL: %s", got)
+	}
+}
+
+func TestTimedVBF3PutWithTTL(t *testing.T) {
+	tf, c := newTestTimedVBF3(t, 10)
+	c.Add(30 * time.Second)
+	for _, d := range []struct {
+		s   string
+		ttl time.Duration
+	}{
+		{"foo", time.Second},
+		{"bar", 2 * time.Minute},
+		{"baz", 9 * time.Minute},
+	} {
+		err := tf.PutWithTTL([]byte(d.s), d.ttl)
+		if err != nil {
+			t.Fatalf("put %q failed: %s", d.s, err)
+		}
+	}
+	err := tf.PutWithTTL([]byte("qux"), tf.MaxTTL())
+	if err != nil {
+		t.Fatalf("put with MaxTTL failed: %s", err)
+	}
+
+	// data is kept until the end of generation which covers ttl.
+	c.Add(29 * time.Second)
+	checkTimedVBF3(t, tf, "foo", true)
+	c.Add(time.Second)
+	checkTimedVBF3(t, tf, "foo", false)
+	checkTimedVBF3(t, tf, "bar", true)
+
+	c.Add(2 * time.Minute)
+	checkTimedVBF3(t, tf, "bar", false)
+	checkTimedVBF3(t, tf, "baz", true)
+
+	// generations are advanced at once.
+	c.Add(7 * time.Minute)
+	checkTimedVBF3(t, tf, "baz", false)
+
+	// qux is kept for MaxTTL at least.
+	checkTimedVBF3(t, tf, "qux", true)
+	c.Add(30 * time.Second)
+	checkTimedVBF3(t, tf, "qux", true)
+	c.Add(30 * time.Second)
+	checkTimedVBF3(t, tf, "qux", false)
+}
+
+func TestTimedVBF3LongIdle(t *testing.T) {
+	tf, c := newTestTimedVBF3(t, 10)
+	err := tf.PutWithTTL([]byte("foo"), 10*time.Minute)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	// longer than a lap of the ring, data must not be resurrected.
+	for i := 0; i < 10; i++ {
+		c.Add(100 * time.Hour)
+		tf.Advance()
+		checkTimedVBF3(t, tf, "foo", false)
+	}
+	err = tf.PutWithTTL([]byte("bar"), time.Minute)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	checkTimedVBF3(t, tf, "bar", true)
+}
+
+func TestTimedVBF3Invalid(t *testing.T) {
+	for i, tc := range []struct {
+		maxLife  uint8
+		duration time.Duration
+	}{
+		{0, time.Minute},
+		{254, time.Minute},
+		{255, time.Minute},
+		{10, 0},
+		{10, -time.Minute},
+	} {
+		_, err := NewTimedVBF3(1000, 7, tc.maxLife, tc.duration)
+		if err == nil {
+			t.Errorf("#%d should fail: maxLife=%d duration=%s", i, tc.maxLife, tc.duration)
+		}
+	}
+}
+
+func TestTimedVBF3CheckAndPutWithTTL(t *testing.T) {
+	tf, c := newTestTimedVBF3(t, 10)
+	for i, want := range []bool{false, true} {
+		got, err := tf.CheckAndPutWithTTL([]byte("foo"), time.Minute)
+		if err != nil {
+			t.Fatalf("#%d check and put failed: %s", i, err)
+		}
+		if got != want {
+			t.Errorf("#%d unexpected check and put: want=%t got=%t", i, want, got)
+		}
+	}
+	_, err := tf.CheckAndPutWithTTL([]byte("bar"), time.Hour)
+	if err == nil {
+		t.Error("check and put over the window should fail")
+	}
+	checkTimedVBF3(t, tf, "bar", false)
+
+	c.Add(time.Minute)
+	got, err := tf.CheckAndPutWithTTL([]byte("foo"), time.Minute)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	if got {
+		t.Error("foo should be expired")
+	}
+}
@@ -2,16 +2,15 @@ package bloomfilter
 
 import (
 	"fmt"
-
-	"github.com/dgryski/go-metro"
 )
 
 type VBF struct {
-	m int
-	k int
+	m  int
+	k  int
+	ix Indexer
 
 	nbits int
-	data  []byte
+	data  registers
 
 	max  uint8
 	curr uint8
@@ -26,7 +25,7 @@ func vbfBits(ttl uint8) int {
 	return -1
 }
 
-func NewVBF(m, k int, ttl uint8) (*VBF, error) {
+func NewVBF(m, k int, ttl uint8, opts ...Option) (*VBF, error) {
 	if ttl < 1 {
 		ttl = 1
 	}
@@ -37,70 +36,30 @@ func NewVBF(m, k int, ttl uint8) (*VBF, error) {
 	return &VBF{
 		m:     m,
 		k:     k,
+		ix:    newOptions(opts).indexer(),
 		nbits: nbits,
-		data:  make([]byte, (nbits*m+7)/8),
+		data:  newRegisters(m, nbits),
 		max:   ttl,
 		curr:  1,
 	}, nil
 }
 
 func (vf *VBF) indexes(d []byte) []int {
-	indexes := make([]int, vf.k)
-	for i := 0; i < vf.k; i++ {
-		h := metro.Hash64(d, uint64(i))
-		indexes[i] = int(h % uint64(vf.m))
+	var buf indexBuffer
+	xx := vf.ix.Indexes(buf[:0], d, vf.k, uint64(vf.m))
+	indexes := make([]int, len(xx))
+	for i, x := range xx {
+		indexes[i] = int(x)
 	}
 	return indexes
 }
 
 func (vf *VBF) putData(x int, v uint8) {
-	switch vf.nbits {
-	case 1:
-		y := 7 - x%8
-		d := vf.data[x/8]
-		d &= ^(0x01 << y)
-		d |= (v & 0x01) << y
-		vf.data[x/8] = d
-
-	case 2:
-		y := 6 - (x%4)*2
-		d := vf.data[x/4]
-		d &= ^(0x03 << y)
-		d |= (v & 0x03) << y
-		vf.data[x/4] = d
-
-	case 4:
-		y := 4 - (x%2)*4
-		d := vf.data[x/2]
-		d &= ^(0x0f << y)
-		d |= (v & 0x0f) << y
-		vf.data[x/2] = d
-
-	case 8:
-		vf.data[x] = v
-
-	default:
-		// TODO:
-	}
+	vf.data.set(x, vf.nbits, uint16(v))
 }
 
 func (vf *VBF) getData(x int) uint8 {
-	switch vf.nbits {
-	case 1:
-		y := 7 - x%8
-		return (vf.data[x/8] >> y) & 0x01
-	case 2:
-		y := 6 - (x%4)*2
-		return (vf.data[x/4] >> y) & 0x03
-	case 4:
-		y := 4 - (x%2)*4
-		return (vf.data[x/2] >> y) & 0x0f
-	case 8:
-		return vf.data[x]
-	default:
-		// TODO:
-		return 0
-	}
+	return uint8(vf.data.get(x, vf.nbits))
 }
 
 func (vf *VBF) Put(d []byte) {
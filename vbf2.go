@@ -2,94 +2,53 @@ package bloomfilter
 
 import (
 	"fmt"
-
-	"github.com/dgryski/go-metro"
 )
 
 // VBF2 is fix TTL volatile bloom filter.
 // It suppose to replace its backend with Redis.
 type VBF2 struct {
-	m int
-	k int
+	m  int
+	k  int
+	ix Indexer
 
 	nbits uint8
-	data  []byte
+	data  registers
 	max   uint8
 }
 
-func NewVBF2(m, k int, nbits uint8) *VBF2 {
+func NewVBF2(m, k int, nbits uint8, opts ...Option) *VBF2 {
 	if nbits < 1 || nbits > 8 {
 		panic(fmt.Sprintf("nbits out of range"))
 	}
 	return &VBF2{
 		m:     m,
 		k:     k,
+		ix:    newOptions(opts).indexer(),
 		nbits: nbits,
-		data:  make([]byte, (int(nbits)*m+7)/8),
+		data:  newRegisters(m, int(nbits)),
 		max:   uint8((uint16(1) << nbits) - 1),
 	}
 }
 
 func (vf *VBF2) putData(x int, v uint8) {
-	switch vf.nbits {
-	case 1:
-		y := 7 - x%8
-		d := vf.data[x/8]
-		d &= ^(0x01 << y)
-		d |= (v & 0x01) << y
-		vf.data[x/8] = d
-
-	case 2:
-		y := 6 - (x%4)*2
-		d := vf.data[x/4]
-		d &= ^(0x03 << y)
-		d |= (v & 0x03) << y
-		vf.data[x/4] = d
-
-	case 4:
-		y := 4 - (x%2)*4
-		d := vf.data[x/2]
-		d &= ^(0x0f << y)
-		d |= (v & 0x0f) << y
-		vf.data[x/2] = d
-
-	case 8:
-		vf.data[x] = v
-
-	default:
-		panic(fmt.Sprintf("unsuppoted nbits: %d", vf.nbits))
-	}
+	vf.data.set(x, int(vf.nbits), uint16(v))
 }
 
 func (vf *VBF2) getData(x int) uint8 {
-	switch vf.nbits {
-	case 1:
-		y := 7 - x%8
-		return (vf.data[x/8] >> y) & 0x01
-	case 2:
-		y := 6 - (x%4)*2
-		return (vf.data[x/4] >> y) & 0x03
-	case 4:
-		y := 4 - (x%2)*4
-		return (vf.data[x/2] >> y) & 0x0f
-	case 8:
-		return vf.data[x]
-	default:
-		panic(fmt.Sprintf("unsuppoted nbits: %d", vf.nbits))
-	}
+	return uint8(vf.data.get(x, int(vf.nbits)))
 }
 
 func (vf *VBF2) Put(d []byte) {
-	for i := 0; i < vf.k; i++ {
-		x := int(metro.Hash64(d, uint64(i)) % uint64(vf.m))
-		vf.putData(x, vf.max)
+	var buf indexBuffer
+	for _, x := range vf.ix.Indexes(buf[:0], d, vf.k, uint64(vf.m)) {
+		vf.putData(int(x), vf.max)
 	}
 }
 
 func (vf *VBF2) Check(d []byte, bias uint8) bool {
-	for i := 0; i < vf.k; i++ {
-		x := int(metro.Hash64(d, uint64(i)) % uint64(vf.m))
-		v := vf.getData(x)
+	var buf indexBuffer
+	for _, x := range vf.ix.Indexes(buf[:0], d, vf.k, uint64(vf.m)) {
+		v := vf.getData(int(x))
 		if v <= bias {
 			return false
 		}
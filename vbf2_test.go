@@ -100,6 +100,14 @@ func TestVBF2Basic8(t *testing.T) {
 	checkVBF2(t, 1000, 7, 1000, 0.1, 8)
 }
 
+func TestVBF2BasicOddBits(t *testing.T) {
+	for _, nbits := range []uint8{3, 5, 6, 7} {
+		checkVBF2(t, 1000, 7, 200, 0.1, nbits)
+		checkVBF2(t, 1000, 7, 200, 0.5, nbits)
+		checkVBF2(t, 1000, 7, 400, 0.1, nbits)
+	}
+}
+
 func TestVBF2Subtract(t *testing.T) {
 	vf := NewVBF2(2048, 8, 8)
 	for i := 1; i <= 255; i++ {
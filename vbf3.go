@@ -2,26 +2,56 @@ package bloomfilter
 
 import (
 	"fmt"
-
-	"github.com/dgryski/go-metro"
 )
 
 // VBF2 is moving windowed volatile bloom filter.
 type VBF3 struct {
 	m    int
 	k    int
+	ix   Indexer
 	data []byte
 
 	bottom uint8
 	top    uint8
 	max    uint8
+
+	// advanced is number of generations advanced since the last sweep.
+	// -1 means unknown, then the filter is swept before next advance.
+	advanced int
+}
+
+// WraparoundError is returned when advancing generations would bring expired
+// registers back into the valid window. It happens when a filter is advanced
+// more than 255-maxLife generations since the last sweep, because generations
+// are stored in a ring of 1..255.
+type WraparoundError struct {
+	MaxLife uint8
+	// Advanced is number of generations advanced since the last sweep, or
+	// -1 when it is unknown.
+	Advanced int
+	// Generations is number of generations requested to advance.
+	Generations int
+}
+
+func (e *WraparoundError) Error() string {
+	if e.Advanced < 0 {
+		return fmt.Sprintf("advancing %d generations may resurrect expired registers: not swept yet (max_life=%d)", e.Generations, e.MaxLife)
+	}
+	return fmt.Sprintf("advancing %d generations resurrects expired registers: advanced %d since the last sweep (max_life=%d)", e.Generations, e.Advanced, e.MaxLife)
+}
+
+// wraparoundBudget returns number of generations which can be advanced safely
+// after a sweep.
+func wraparoundBudget(maxLife uint8) int {
+	return 255 - int(maxLife)
 }
 
 // NewVBF3 creates a VBF.
-func NewVBF3(m, k int, maxLife uint8) *VBF3 {
+func NewVBF3(m, k int, maxLife uint8, opts ...Option) *VBF3 {
 	return &VBF3{
 		m:    m,
 		k:    k,
+		ix:   newOptions(opts).indexer(),
 		data: make([]byte, m),
 
 		bottom: 1,
@@ -38,10 +68,6 @@ func (f *VBF3) m255p1add(a, b uint8) uint8 {
 	return uint8(v - 255)
 }
 
-func (f *VBF3) hash(d []byte, n int) int {
-	return int(metro.Hash64(d, uint64(n)) % uint64(f.m))
-}
-
 func (f *VBF3) isValid(n uint8) bool {
 	if n == 0 {
 		return false
@@ -68,24 +94,42 @@ func (f *VBF3) currLife(x int) uint8 {
 
 // Put puts a data with life (number of generations until expire)
 func (f *VBF3) Put(d []byte, life uint8) {
+	f.put(d, life)
+}
+
+// put puts a data with life, and returns true when the data was available
+// before.
+func (f *VBF3) put(d []byte, life uint8) bool {
 	if life > f.max {
 		panic(fmt.Sprintf("life should be <= %d", f.max))
 	}
 	nv := f.m255p1add(f.bottom, life-1)
-	for i := 0; i < f.k; i++ {
-		x := f.hash(d, i)
-		v := f.currLife(x)
+	retval := true
+	var buf indexBuffer
+	for _, x := range f.ix.Indexes(buf[:0], d, f.k, uint64(f.m)) {
+		v := f.currLife(int(x))
+		if v == 0 {
+			retval = false
+		}
 		if v == 0 || life > v {
 			f.data[x] = nv
 		}
 	}
+	return retval
+}
+
+// CheckAndPut checks a data is available or not, and puts it with life.
+// It returns true when the data was available before, with a hash
+// computation.
+func (f *VBF3) CheckAndPut(d []byte, life uint8) bool {
+	return f.put(d, life)
 }
 
 // Check checks a data is available or not.
 func (f *VBF3) Check(d []byte) bool {
 	retval := true
-	for i := 0; i < f.k; i++ {
-		x := f.hash(d, i)
+	var buf indexBuffer
+	for _, x := range f.ix.Indexes(buf[:0], d, f.k, uint64(f.m)) {
 		v := f.data[x]
 		if !f.isValid(v) {
 			retval = false
@@ -99,7 +143,37 @@ func (f *VBF3) Check(d []byte) bool {
 
 // AdvanceGeneration advances generation.
 // If the generation exhausted, data will be expired/evaporated.
-func (f *VBF3) AdvanceGeneration(generations uint8) {
+//
+// Expired registers come back into the valid window after 255-maxLife
+// generations, so the filter is swept automatically before that. It returns
+// WraparoundError when maxLife is 255, because then any advance resurrects
+// expired registers.
+func (f *VBF3) AdvanceGeneration(generations uint8) error {
+	budget := wraparoundBudget(f.max)
+	if budget == 0 && generations > 0 {
+		return &WraparoundError{
+			MaxLife:     f.max,
+			Advanced:    f.advanced,
+			Generations: int(generations),
+		}
+	}
+	for g := int(generations); g > 0; {
+		if f.advanced < 0 || f.advanced >= budget {
+			f.Sweep()
+		}
+		n := budget - f.advanced
+		if n > g {
+			n = g
+		}
+		f.rotate(uint8(n))
+		f.advanced += n
+		g -= n
+	}
+	return nil
+}
+
+// rotate moves the window of generations without any checks.
+func (f *VBF3) rotate(generations uint8) {
 	f.bottom = f.m255p1add(f.bottom, generations)
 	f.top = f.m255p1add(f.top, generations)
 }
@@ -111,4 +185,5 @@ func (f *VBF3) Sweep() {
 			f.data[i] = 0
 		}
 	}
+	f.advanced = 0
 }
@@ -0,0 +1,130 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+func (f *VBF3) marshalHeader() marshalHeader {
+	return marshalHeader{
+		kind: marshalKindVBF3,
+		m:    uint64(f.m),
+		k:    uint64(f.k),
+		hasher: HasherIdentity{
+			Name:          f.ix.Name(),
+			Seed:          f.ix.Seed,
+			DoubleHashing: f.ix.DoubleHashing,
+		},
+	}
+}
+
+// WriteTo writes the filter to w in binary form, includes the generation
+// window.
+func (f *VBF3) WriteTo(w io.Writer) (int64, error) {
+	bw := newBinaryWriter(w)
+	bw.header(f.marshalHeader())
+	bw.uint8(f.bottom)
+	bw.uint8(f.top)
+	bw.uint8(f.max)
+	bw.bytes(f.data)
+	return bw.finish()
+}
+
+// ReadFrom reads the filter from r, which was written by WriteTo.
+// When the filter is a zero value, it takes all parameters from r, includes
+// the hash which is resolved by HashByName.
+// Otherwise it fails when parameters (m, k, maxLife, hash) are not matched.
+func (f *VBF3) ReadFrom(r io.Reader) (int64, error) {
+	n, nf, err := f.readFrom(r)
+	if err != nil {
+		return n, err
+	}
+	*f = *nf
+	return n, nil
+}
+
+// readFrom reads and verifies the filter from r, and returns a new filter.
+func (f *VBF3) readFrom(r io.Reader) (int64, *VBF3, error) {
+	br := newBinaryReader(r)
+	h := br.header()
+	if br.err != nil {
+		return br.n, nil, br.err
+	}
+	want := f.marshalHeader()
+	ix := f.ix
+	if f.m == 0 {
+		if h.m == 0 || h.k == 0 || h.m > uint64(maxInt) || h.k > uint64(maxInt) {
+			return br.n, nil, fmt.Errorf("invalid parameter: m=%d k=%d", h.m, h.k)
+		}
+		hash := HashByName(h.hasher.Name)
+		if hash == nil {
+			return br.n, nil, fmt.Errorf("unknown hash %q: use a filter configured with the hash", h.hasher.Name)
+		}
+		ix = Indexer{
+			Hash:          hash,
+			Seed:          h.hasher.Seed,
+			DoubleHashing: h.hasher.DoubleHashing,
+		}
+		want.m, want.k, want.hasher = h.m, h.k, h.hasher
+	}
+	err := h.verify(want)
+	if err != nil {
+		return br.n, nil, err
+	}
+	nf := &VBF3{
+		m:      int(h.m),
+		k:      int(h.k),
+		ix:     ix,
+		bottom: br.uint8(),
+		top:    br.uint8(),
+		max:    br.uint8(),
+
+		// registers may be advanced without sweep before marshaled.
+		advanced: -1,
+	}
+	if br.err != nil {
+		return br.n, nil, br.err
+	}
+	if f.m != 0 && nf.max != f.max {
+		return br.n, nil, fmt.Errorf("max life mismatch: want=%d got=%d", f.max, nf.max)
+	}
+	if nf.bottom == 0 || nf.top == 0 || nf.max == 0 || nf.top != f.m255p1add(nf.bottom, nf.max-1) {
+		return br.n, nil, fmt.Errorf("invalid generation: bottom=%d top=%d max=%d", nf.bottom, nf.top, nf.max)
+	}
+	nf.data = br.bytesN(h.m)
+	n, err := br.finish()
+	if err != nil {
+		return n, nil, err
+	}
+	return n, nf, nil
+}
+
+// MarshalBinary encodes the filter into binary form, includes the generation
+// window.
+func (f *VBF3) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	_, err := f.WriteTo(&b)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalBinary decodes the filter from binary form, which was encoded by
+// MarshalBinary.
+// When the filter is a zero value, it takes all parameters from data, includes
+// the hash which is resolved by HashByName.
+// Otherwise it fails when parameters (m, k, maxLife, hash) are not matched.
+func (f *VBF3) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	_, nf, err := f.readFrom(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("extra %d bytes after the filter", r.Len())
+	}
+	*f = *nf
+	return nil
+}
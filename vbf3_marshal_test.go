@@ -0,0 +1,246 @@
+package bloomfilter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func TestVBF3MarshalBinary(t *testing.T) {
+	f := NewVBF3(1000, 7, 10)
+	for i := 1; i <= 10; i++ {
+		f.Put([]byte(strconv.Itoa(i)), uint8(i))
+	}
+	// move the window across the end of the ring.
+	f.AdvanceGeneration(250)
+
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	for _, f2 := range []*VBF3{{}, NewVBF3(1000, 7, 10)} {
+		err = f2.UnmarshalBinary(b)
+		if err != nil {
+			t.Fatalf("unmarshal failed: %s", err)
+		}
+		testTopBottom(t, f2, f.bottom, f.top)
+		if !bytes.Equal(f.data, f2.data) {
+			t.Fatal("data mismatch after unmarshal")
+		}
+		for i := 1; i <= 10; i++ {
+			f.AdvanceGeneration(1)
+			f2.AdvanceGeneration(1)
+			for j := 1; j <= 10; j++ {
+				d := []byte(strconv.Itoa(j))
+				want, got := f.Check(d), f2.Check(d)
+				if got != want {
+					t.Errorf("check mismatch i=%d j=%d: want=%t got=%t", i, j, want, got)
+				}
+			}
+		}
+		f.UnmarshalBinary(b)
+	}
+}
+
+func TestVBF3WriteToReadFrom(t *testing.T) {
+	f := NewVBF3(1000, 7, 64)
+	f.Put([]byte("foo"), 64)
+	var b bytes.Buffer
+	nw, err := f.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo failed: %s", err)
+	}
+	var f2 VBF3
+	nr, err := f2.ReadFrom(&b)
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %s", err)
+	}
+	if nr != nw {
+		t.Errorf("ReadFrom returns wrong size: want=%d got=%d", nw, nr)
+	}
+	if !f2.Check([]byte("foo")) {
+		t.Error("false negative after ReadFrom")
+	}
+}
+
+func TestVBF3UnmarshalMismatch(t *testing.T) {
+	b, err := NewVBF3(1000, 7, 10).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	for i, f := range []*VBF3{
+		NewVBF3(1001, 7, 10),
+		NewVBF3(1000, 6, 10),
+		NewVBF3(1000, 7, 11),
+	} {
+		err := f.UnmarshalBinary(b)
+		if err == nil {
+			t.Errorf("unmarshal should fail with mismatched filter #%d", i)
+		}
+	}
+
+	b2, err := newTestBF(t, 1000, 7, 0).MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal BF failed: %s", err)
+	}
+	var f VBF3
+	if err := f.UnmarshalBinary(b2); err == nil {
+		t.Error("unmarshal should fail with BF data")
+	}
+	for _, x := range []int{0, len(b) / 2, len(b) - 1} {
+		broken := append([]byte(nil), b...)
+		broken[x] ^= 0x01
+		if err := f.UnmarshalBinary(broken); err == nil {
+			t.Errorf("unmarshal should fail with broken data at %d", x)
+		}
+	}
+	if err := f.UnmarshalBinary(append(b, 0)); err == nil {
+		t.Error("unmarshal should fail with extra data")
+	}
+	if f.m != 0 || f.data != nil {
+		t.Fatal("filter is modified by failed unmarshal")
+	}
+}
+
+func TestVBF3UnmarshalInvalidParams(t *testing.T) {
+	for _, tc := range []struct {
+		m, k uint64
+	}{
+		{0, 7},
+		{1000, 0},
+	} {
+		// a payload with valid checksum.
+		h := NewVBF3(1000, 7, 10).marshalHeader()
+		h.m, h.k = tc.m, tc.k
+		var b bytes.Buffer
+		bw := newBinaryWriter(&b)
+		bw.header(h)
+		bw.uint8(1)
+		bw.uint8(10)
+		bw.uint8(10)
+		bw.bytes(make([]byte, tc.m))
+		if _, err := bw.finish(); err != nil {
+			t.Fatal(err)
+		}
+		var f VBF3
+		if err := f.UnmarshalBinary(b.Bytes()); err == nil {
+			t.Errorf("unmarshal should fail: m=%d k=%d", tc.m, tc.k)
+		}
+	}
+}
+
+func TestVBF3UnmarshalHugeM(t *testing.T) {
+	// a header claims a huge m, but the payload is short.
+	const m = 1 << 40
+	if uint64(maxInt) < m {
+		t.Skip("m is rejected on 32 bits platforms")
+	}
+	h := NewVBF3(1000, 7, 10).marshalHeader()
+	h.m = m
+	var b bytes.Buffer
+	bw := newBinaryWriter(&b)
+	bw.header(h)
+	bw.uint8(1)
+	bw.uint8(10)
+	bw.uint8(10)
+	bw.uint64(m)
+	bw.write(make([]byte, 1000))
+	if _, err := bw.finish(); err != nil {
+		t.Fatal(err)
+	}
+	var f VBF3
+	err := f.UnmarshalBinary(b.Bytes())
+	if err == nil {
+		t.Fatal("unmarshal should fail with short payload")
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if f.m != 0 || f.data != nil {
+		t.Fatal("filter is modified by failed unmarshal")
+	}
+}
+
+func TestVBF3MarshalHash(t *testing.T) {
+	f := NewVBF3(1000, 7, 10, WithHash(XXHash{}), WithSeed(42))
+	f.Put([]byte("foo"), 10)
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+
+	// zero value resolves the hash by name.
+	var f2 VBF3
+	err = f2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !f2.Check([]byte("foo")) {
+		t.Error("false negative after unmarshal")
+	}
+
+	for i, f3 := range []*VBF3{
+		NewVBF3(1000, 7, 10),
+		NewVBF3(1000, 7, 10, WithHash(XXHash{})),
+		NewVBF3(1000, 7, 10, WithHash(Murmur3{}), WithSeed(42)),
+	} {
+		err := f3.UnmarshalBinary(b)
+		if err == nil {
+			t.Errorf("#%d unmarshal should fail with hash mismatch", i)
+		}
+	}
+}
+
+func TestVBF3MarshalKeyedHash(t *testing.T) {
+	sh := SipHash{K0: 1, K1: 2}
+	f := NewVBF3(1000, 7, 10, WithHash(sh))
+	f.Put([]byte("foo"), 10)
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	var f2 VBF3
+	err = f2.UnmarshalBinary(b)
+	if err == nil {
+		t.Fatal("unmarshal keyed hash into zero value should fail")
+	}
+	f3 := NewVBF3(1000, 7, 10, WithHash(sh))
+	err = f3.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !f3.Check([]byte("foo")) {
+		t.Error("false negative after unmarshal")
+	}
+	err = NewVBF3(1000, 7, 10, WithHash(SipHash{K0: 1, K1: 3})).UnmarshalBinary(b)
+	if err == nil {
+		t.Error("unmarshal with other key should fail")
+	}
+}
+
+func TestVBF3MarshalDoubleHashing(t *testing.T) {
+	f := NewVBF3(1000, 7, 10, WithDoubleHashing())
+	f.Put([]byte("foo"), 10)
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	var f2 VBF3
+	err = f2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	if !f2.ix.DoubleHashing {
+		t.Error("double hashing is not restored")
+	}
+	if !f2.Check([]byte("foo")) {
+		t.Error("false negative after unmarshal")
+	}
+	err = NewVBF3(1000, 7, 10).UnmarshalBinary(b)
+	if err == nil {
+		t.Error("unmarshal without double hashing should fail")
+	}
+}
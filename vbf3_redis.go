@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 
-	"github.com/dgryski/go-metro"
 	"github.com/go-redis/redis/v8"
 )
 
@@ -25,11 +25,15 @@ func watchWithRetry(ctx context.Context, uc redis.UniversalClient, fn func(tx *r
 
 // VBF3Redis provides VBF3 with Redis backend.
 type VBF3Redis struct {
-	c       redis.UniversalClient
-	keyData string
-	keyGen  string
-	m       int
-	k       int
+	c        redis.UniversalClient
+	keyData  string
+	keyGen   string
+	keySweep string
+	m        int
+	k        int
+	ix       Indexer
+
+	autoSweep bool
 }
 
 // VBF3Gen codes generation parameters of VBF3.
@@ -37,6 +41,23 @@ type VBF3Gen struct {
 	Bottom uint8 `json:"bottom"`
 	Top    uint8 `json:"top"`
 	Max    uint8 `json:"max"`
+	// Hash is name of the hash algorithm. Empty means "metro".
+	Hash string `json:"hash,omitempty"`
+	// DoubleHashing is true when indexes are derived by double hashing.
+	DoubleHashing bool `json:"double_hashing,omitempty"`
+	// Seed is base of seeds for hash functions. It is encoded as a string
+	// to keep 64 bits in Lua scripts.
+	Seed uint64 `json:"seed,string,omitempty"`
+	// Advanced is number of generations advanced since the last sweep.
+	// nil means unknown, for generation info created by older versions.
+	Advanced *int `json:"advanced,omitempty"`
+}
+
+func (g *VBF3Gen) hashName() string {
+	if g.Hash == "" {
+		return (MetroHash{}).Name()
+	}
+	return g.Hash
 }
 
 func (g *VBF3Gen) isValid(n uint8) bool {
@@ -51,26 +72,53 @@ func (g *VBF3Gen) isValid(n uint8) bool {
 	return a || b
 }
 
-func NewVBF3Redis(uc redis.UniversalClient, name string, m, k int) *VBF3Redis {
+func NewVBF3Redis(uc redis.UniversalClient, name string, m, k int, opts ...Option) *VBF3Redis {
+	o := newOptions(opts)
 	return &VBF3Redis{
-		c:       uc,
-		keyData: name,
-		keyGen:  name + "_gen",
-		m:       m,
-		k:       k,
+		c:        uc,
+		keyData:  name,
+		keyGen:   name + "_gen",
+		keySweep: name + "_sweep",
+		m:        m,
+		k:        k,
+		ix:       o.indexer(),
+
+		autoSweep: o.autoSweep,
+	}
+}
+
+// hashName returns name of the hash for VBF3Gen.
+func (rf *VBF3Redis) hashName() string {
+	if n := rf.ix.Name(); n != (MetroHash{}).Name() {
+		return n
 	}
+	return ""
 }
 
 func (rf *VBF3Redis) getGen(ctx context.Context, c redis.Cmdable) (*VBF3Gen, error) {
-	b, err := c.Get(ctx, rf.keyGen).Bytes()
+	return rf.parseGen(c.Get(ctx, rf.keyGen).Result())
+}
+
+// parseGen parses and verifies a result of GET for generation info.
+func (rf *VBF3Redis) parseGen(s string, err error) (*VBF3Gen, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get generation info with key %q: %w", rf.keyGen, err)
 	}
 	var v *VBF3Gen
-	err = json.Unmarshal(b, &v)
+	err = json.Unmarshal([]byte(s), &v)
 	if err != nil {
 		return nil, fmt.Errorf("invalid format of generation info: %w", err)
 	}
+	if v.Hash != rf.hashName() {
+		return nil, fmt.Errorf("hash mismatch: want=%q got=%q", rf.ix.Name(), v.hashName())
+	}
+	if v.DoubleHashing != rf.ix.DoubleHashing {
+		return nil, fmt.Errorf("double hashing mismatch: want=%t got=%t", rf.ix.DoubleHashing, v.DoubleHashing)
+	}
+	if v.Seed != rf.ix.Seed {
+		// don't reveal seeds, they may be secrets.
+		return nil, errors.New("seed mismatch")
+	}
 	return v, nil
 }
 
@@ -93,8 +141,14 @@ func (rf *VBF3Redis) setData(ctx context.Context, c redis.Cmdable, x int, v uint
 	return nil
 }
 
-func (rf *VBF3Redis) hash(d []byte, n int) int {
-	return int(metro.Hash64(d, uint64(n)) % uint64(rf.m))
+func (rf *VBF3Redis) indexes(d []byte) []int {
+	var buf indexBuffer
+	xx := rf.ix.Indexes(buf[:0], d, rf.k, uint64(rf.m))
+	indexes := make([]int, len(xx))
+	for i, x := range xx {
+		indexes[i] = int(x)
+	}
+	return indexes
 }
 
 func (rf *VBF3Redis) Put(ctx context.Context, d []byte, life uint8) error {
@@ -110,8 +164,7 @@ func (rf *VBF3Redis) put1(ctx context.Context, d []byte, life uint8) error {
 		return fmt.Errorf("life should be less than (<=) %d", gen.Max)
 	}
 	nv := m255p1add(gen.Bottom, life-1)
-	for i := 0; i < rf.k; i++ {
-		x := rf.hash(d, i)
+	for _, x := range rf.indexes(d) {
 		v, err := rf.getData(ctx, rf.c, x)
 		if err != nil {
 			return err
@@ -142,11 +195,9 @@ func (rf *VBF3Redis) put2(ctx context.Context, d []byte, life uint8) error {
 		return fmt.Errorf("life should be less than (<=) %d", gen.Max)
 	}
 
-	xx := make([]int, rf.k)
+	xx := rf.indexes(d)
 	readArgs := make([]interface{}, 0, rf.k*3)
-	for i := 0; i < rf.k; i++ {
-		x := rf.hash(d, i)
-		xx[i] = x
+	for _, x := range xx {
 		readArgs = append(readArgs, "GET", "u8", x*8)
 	}
 	r, err := rf.c.BitField(ctx, rf.keyData, readArgs...).Result()
@@ -178,6 +229,190 @@ func (rf *VBF3Redis) put2(ctx context.Context, d []byte, life uint8) error {
 	return nil
 }
 
+// vbf3PutScript puts registers with life atomically.
+//
+//	KEYS[1]  data key
+//	KEYS[2]  generation key
+//	ARGV     life, hash name, double hashing ("1" or "0"), seed (decimal) and
+//	         offsets of registers
+//
+// It returns 1 when all registers were valid before, otherwise 0.
+var vbf3PutScript = redis.NewScript(`
+local s = redis.call('GET', KEYS[2])
+if not s then
+  return redis.error_reply('no generation info: ' .. KEYS[2])
+end
+local g = cjson.decode(s)
+if (g['hash'] or '') ~= ARGV[2] then
+  return redis.error_reply('hash mismatch: ' .. tostring(g['hash']))
+end
+if (g['double_hashing'] and '1' or '0') ~= ARGV[3] then
+  return redis.error_reply('double hashing mismatch')
+end
+if (g['seed'] or '0') ~= ARGV[4] then
+  return redis.error_reply('seed mismatch')
+end
+local bottom, top = g['bottom'], g['top']
+local life = tonumber(ARGV[1])
+if life > g['max'] then
+  return redis.error_reply('life should be less than (<=) ' .. g['max'])
+end
+local nv = bottom + life - 1
+if nv > 255 then
+  nv = nv - 255
+end
+
+-- bitfield calls BITFIELD with ops which have w arguments for each,
+-- splitting them to avoid too many arguments for unpack.
+local function bitfield(args, w)
+  local rv = {}
+  local step = w * 1000
+  for i = 1, #args, step do
+    local r = redis.call('BITFIELD', KEYS[1], unpack(args, i, math.min(i + step - 1, #args)))
+    for _, v in ipairs(r) do
+      table.insert(rv, v)
+    end
+  end
+  return rv
+end
+
+local args = {}
+for i = 5, #ARGV do
+  table.insert(args, 'GET')
+  table.insert(args, 'u8')
+  table.insert(args, ARGV[i])
+end
+local vals = bitfield(args, 3)
+local rv = 1
+args = {}
+for i, v in ipairs(vals) do
+  local curr = 0
+  if v ~= 0 and ((bottom <= top and bottom <= v and v <= top) or (bottom > top and (bottom <= v or v <= top))) then
+    curr = v - bottom + 1
+    if v < bottom then
+      curr = curr - 1
+    end
+  end
+  if curr == 0 then
+    rv = 0
+  end
+  if curr == 0 or life > curr then
+    table.insert(args, 'SET')
+    table.insert(args, 'u8')
+    table.insert(args, ARGV[i + 4])
+    table.insert(args, nv)
+  end
+end
+bitfield(args, 4)
+return rv
+`)
+
+// runPutScript puts registers at indexes by vbf3PutScript, and returns true
+// when all registers were valid before.
+func (rf *VBF3Redis) runPutScript(ctx context.Context, xx []int, life uint8) (bool, error) {
+	dh := "0"
+	if rf.ix.DoubleHashing {
+		dh = "1"
+	}
+	args := make([]interface{}, 0, 4+len(xx))
+	args = append(args, life, rf.hashName(), dh, strconv.FormatUint(rf.ix.Seed, 10))
+	for _, x := range xx {
+		args = append(args, x*8)
+	}
+	r, err := vbf3PutScript.Run(ctx, rf.c, []string{rf.keyData, rf.keyGen}, args...).Int64()
+	if err != nil {
+		return false, err
+	}
+	return r != 0, nil
+}
+
+// CheckAndPut checks a data is available or not, and puts it with life.
+// It returns true when the data was available before.
+// It is done by a script atomically in a round-trip, so the data key and the
+// generation key should be in a slot on Redis Cluster.
+func (rf *VBF3Redis) CheckAndPut(ctx context.Context, d []byte, life uint8) (bool, error) {
+	r, err := rf.runPutScript(ctx, rf.indexes(d), life)
+	if err != nil {
+		return false, fmt.Errorf("failed to check and put: %w", err)
+	}
+	return r, nil
+}
+
+// indexesAll returns indexes for each data.
+func (rf *VBF3Redis) indexesAll(dd [][]byte) [][]uint64 {
+	all := make([][]uint64, len(dd))
+	for i, d := range dd {
+		all[i] = rf.ix.Indexes(nil, d, rf.k, uint64(rf.m))
+	}
+	return all
+}
+
+// PutAll puts all data with life, by a script atomically in a round-trip.
+// Same as CheckAndPut, the data key and the generation key should be in a
+// slot on Redis Cluster.
+func (rf *VBF3Redis) PutAll(ctx context.Context, life uint8, dd [][]byte) error {
+	if len(dd) == 0 {
+		return nil
+	}
+	uniq, _ := uniqueIndexes(rf.indexesAll(dd))
+	xx := make([]int, len(uniq))
+	for i, x := range uniq {
+		xx[i] = int(x)
+	}
+	_, err := rf.runPutScript(ctx, xx, life)
+	if err != nil {
+		return fmt.Errorf("failed to put all: %w", err)
+	}
+	return nil
+}
+
+// CheckAll checks all data are available or not, by a pipelined round-trip.
+// It returns results in the order of dd.
+// Unlike Check, it doesn't clear invalid registers. Sweep clears them.
+func (rf *VBF3Redis) CheckAll(ctx context.Context, dd [][]byte) ([]bool, error) {
+	if len(dd) == 0 {
+		return nil, nil
+	}
+	all := rf.indexesAll(dd)
+	uniq, pos := uniqueIndexes(all)
+	args := make([]interface{}, 0, 3*len(uniq))
+	for _, x := range uniq {
+		args = append(args, "GET", "u8", x*8)
+	}
+	var genCmd *redis.StringCmd
+	var valsCmd *redis.IntSliceCmd
+	_, err := rf.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		genCmd = pipe.Get(ctx, rf.keyGen)
+		valsCmd = pipe.BitField(ctx, rf.keyData, args...)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to check all: %w", err)
+	}
+	gen, err := rf.parseGen(genCmd.Val(), genCmd.Err())
+	if err != nil {
+		return nil, err
+	}
+	vals, err := valsCmd.Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check all: %w", err)
+	}
+	if len(vals) != len(uniq) {
+		return nil, fmt.Errorf("unexpected length of response for check all: want=%d got=%d", len(uniq), len(vals))
+	}
+	rr := make([]bool, len(dd))
+	for i, xx := range all {
+		rr[i] = true
+		for _, x := range xx {
+			if !gen.isValid(uint8(vals[pos[x]])) {
+				rr[i] = false
+				break
+			}
+		}
+	}
+	return rr, nil
+}
+
 type vbf3pair struct {
 	x int
 	v uint8
@@ -188,12 +423,10 @@ func (rf *VBF3Redis) Check(ctx context.Context, d []byte) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	xx := make([]int, rf.k)
+	xx := rf.indexes(d)
 	args := make([]interface{}, 0, 3*rf.k)
-	for i := 0; i < rf.k; i++ {
-		x := rf.hash(d, i)
+	for _, x := range xx {
 		args = append(args, "GET", "u8", x*8)
-		xx[i] = x
 	}
 	vv, err := rf.c.BitField(ctx, rf.keyData, args...).Result()
 	if err != nil {
@@ -221,14 +454,70 @@ func (rf *VBF3Redis) Check(ctx context.Context, d []byte) (bool, error) {
 	return retval, nil
 }
 
+// AdvanceGeneration advances generation.
+// It returns WraparoundError when advancing would resurrect expired
+// registers, which are not swept yet. Then call Sweep and retry, or use
+// WithAutoSweep option.
+// Generation info of old versions doesn't know advanced generations since the
+// last sweep, so it sweeps once before advancing such a filter.
 func (rf *VBF3Redis) AdvanceGeneration(ctx context.Context, generations uint8) error {
-	return watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
+	swept := false
+	for g := int(generations); g > 0; {
+		n, err := rf.advance(ctx, g)
+		if err != nil {
+			var werr *WraparoundError
+			if !errors.As(err, &werr) || wraparoundBudget(werr.MaxLife) == 0 {
+				return err
+			}
+			if werr.Advanced < 0 {
+				// the sweep should record advanced generations.
+				if swept {
+					return err
+				}
+			} else if !rf.autoSweep {
+				return err
+			}
+			swept = true
+			err := rf.Sweep(ctx)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		g -= n
+	}
+	return nil
+}
+
+// advance advances generation within the budget of wraparound, and returns
+// number of advanced generations. Without autoSweep, it advances all or
+// nothing.
+func (rf *VBF3Redis) advance(ctx context.Context, generations int) (int, error) {
+	var n int
+	err := watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
 		gen, err := rf.getGen(tx.Context(), tx)
 		if err != nil {
 			return err
 		}
-		gen.Bottom = m255p1add(gen.Bottom, generations)
-		gen.Top = m255p1add(gen.Top, generations)
+		advanced := -1
+		if gen.Advanced != nil {
+			advanced = *gen.Advanced
+		}
+		n = wraparoundBudget(gen.Max) - advanced
+		if advanced < 0 || n <= 0 || (!rf.autoSweep && n < generations) {
+			return &WraparoundError{
+				MaxLife:     gen.Max,
+				Advanced:    advanced,
+				Generations: generations,
+			}
+		}
+		if n > generations {
+			n = generations
+		}
+		gen.Bottom = m255p1add(gen.Bottom, uint8(n))
+		gen.Top = m255p1add(gen.Top, uint8(n))
+		advanced += n
+		gen.Advanced = &advanced
 		next, err := json.Marshal(gen)
 		if err != nil {
 			return err
@@ -239,40 +528,130 @@ func (rf *VBF3Redis) AdvanceGeneration(ctx context.Context, generations uint8) e
 		})
 		return err
 	}, rf.keyGen)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
+// vbf3SweepChunkSize is number of registers which are swept by a step of
+// Sweep.
+const vbf3SweepChunkSize = 64 * 1024
+
+// vbf3SweepScript clears invalid registers in a chunk atomically, and
+// advances the cursor.
+//
+//	KEYS[1]  data key
+//	KEYS[2]  generation key
+//	KEYS[3]  cursor key
+//	ARGV     offset, size and bottom generation when the sweep started (-1
+//	         for a new sweep)
+//
+// It returns number of cleared registers, and 1 when the sweep is done
+// otherwise 0. When it is done, it deletes the cursor and records advanced
+// generations since the sweep started in the generation info.
+var vbf3SweepScript = redis.NewScript(`
+local s = redis.call('GET', KEYS[2])
+if not s then
+  return redis.error_reply('no generation info: ' .. KEYS[2])
+end
+local g = cjson.decode(s)
+local bottom, top = g['bottom'], g['top']
+local off, size, start = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+if start < 0 then
+  start = bottom
+end
+local d = redis.call('GETRANGE', KEYS[1], off, off + size - 1)
+local args = {}
+for i = 1, #d do
+  local v = string.byte(d, i)
+  if v ~= 0 and not ((bottom <= top and bottom <= v and v <= top) or (bottom > top and (bottom <= v or v <= top))) then
+    table.insert(args, 'SET')
+    table.insert(args, 'u8')
+    table.insert(args, (off + i - 1) * 8)
+    table.insert(args, 0)
+  end
+end
+-- split ops to avoid too many arguments for unpack.
+local step = 4 * 1000
+for i = 1, #args, step do
+  redis.call('BITFIELD', KEYS[1], unpack(args, i, math.min(i + step - 1, #args)))
+end
+off = off + size
+if off >= redis.call('STRLEN', KEYS[1]) then
+  redis.call('DEL', KEYS[3])
+  g['advanced'] = (bottom - start) % 255
+  redis.call('SET', KEYS[2], cjson.encode(g))
+  return {#args / 4, 1}
+end
+redis.call('SET', KEYS[3], off .. ':' .. start)
+return {#args / 4, 0}
+`)
+
+// Sweep cleans up all expired registers, and resets the counter of advanced
+// generations for AdvanceGeneration, by repeating SweepStep until the end of
+// registers. Each step blocks Redis only for a chunk, so it doesn't conflict
+// with concurrent Put and AdvanceGeneration. It continues an interrupted
+// sweep or a sweep by other processes, from the cursor in Redis.
+// Same as CheckAndPut, the data key and the generation key (and the cursor
+// key "{name}_sweep") should be in a slot on Redis Cluster.
 func (rf *VBF3Redis) Sweep(ctx context.Context) error {
-	//defer func(st time.Time) {
-	//	log.Printf("Sweep took %s", time.Since(st))
-	//}(time.Now())
-	gen, err := rf.getGen(ctx, rf.c)
-	if err != nil {
-		return err
-	}
-	return watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
-		b, err := tx.Get(tx.Context(), rf.keyData).Bytes()
-		if err != nil {
-			if errors.Is(err, redis.Nil) {
-				return nil
-			}
+	for {
+		if err := ctx.Err(); err != nil {
 			return err
 		}
-		var modified bool
-		for i, d := range b {
-			if d != 0 && !gen.isValid(d) {
-				b[i] = 0
-				modified = true
-			}
+		done, err := rf.SweepStep(ctx, vbf3SweepChunkSize)
+		if err != nil {
+			return err
 		}
-		if !modified {
+		if done {
 			return nil
 		}
-		_, err = tx.Pipelined(tx.Context(), func(pipe redis.Pipeliner) error {
-			pipe.Set(tx.Context(), rf.keyData, b, 0)
-			return nil
-		})
-		return err
-	}, rf.keyData)
+	}
+}
+
+func (rf *VBF3Redis) getSweepCursor(ctx context.Context) (offset, start int, err error) {
+	s, err := rf.c.Get(ctx, rf.keySweep).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, -1, nil
+		}
+		return 0, 0, fmt.Errorf("failed to get sweep cursor with key %q: %w", rf.keySweep, err)
+	}
+	n, _ := fmt.Sscanf(s, "%d:%d", &offset, &start)
+	if n != 2 || offset < 0 || start < 1 || start > 255 {
+		return 0, 0, fmt.Errorf("invalid sweep cursor: %q", s)
+	}
+	return offset, start, nil
+}
+
+// SweepStep clears expired registers in a chunk of size registers, from a
+// cursor which is stored in Redis, then advances the cursor.
+// It returns true when the cursor reaches the end of registers, and the
+// cursor is reset. So repeating SweepStep sweeps whole registers, and it can
+// be resumed by other processes.
+func (rf *VBF3Redis) SweepStep(ctx context.Context, size int) (bool, error) {
+	if size <= 0 {
+		return false, fmt.Errorf("size should be positive: %d", size)
+	}
+	// verify the generation info before changing registers.
+	_, err := rf.getGen(ctx, rf.c)
+	if err != nil {
+		return false, err
+	}
+	offset, start, err := rf.getSweepCursor(ctx)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{rf.keyData, rf.keyGen, rf.keySweep}
+	r, err := vbf3SweepScript.Run(ctx, rf.c, keys, offset, size, start).Int64Slice()
+	if err != nil {
+		return false, fmt.Errorf("failed to sweep at %d: %w", offset, err)
+	}
+	if len(r) != 2 {
+		return false, fmt.Errorf("unexpected result of sweep: %+v", r)
+	}
+	return r[1] != 0, nil
 }
 
 func m255p1add(a, b uint8) uint8 {
@@ -287,6 +666,7 @@ func (rf *VBF3Redis) Delete(ctx context.Context) error {
 	_, err := rf.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
 		pipe.Del(ctx, rf.keyData)
 		pipe.Del(ctx, rf.keyGen)
+		pipe.Del(ctx, rf.keySweep)
 		return nil
 	})
 	return err
@@ -298,11 +678,18 @@ func (rf *VBF3Redis) Prepare(ctx context.Context, maxLife uint8) error {
 		// FIXME: maxLife
 		return nil
 	}
-	// FIXME: check error contents
+	if !errors.Is(err, redis.Nil) {
+		return err
+	}
 	gen = &VBF3Gen{
 		Bottom: 1,
 		Top:    maxLife,
 		Max:    maxLife,
+		Hash:   rf.hashName(),
+
+		DoubleHashing: rf.ix.DoubleHashing,
+		Seed:          rf.ix.Seed,
+		Advanced:      new(int),
 	}
 	next, err := json.Marshal(gen)
 	if err != nil {
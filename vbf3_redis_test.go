@@ -2,9 +2,11 @@ package bloomfilter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -165,7 +167,7 @@ func BenchmarkVBF3RedisCheck(b *testing.B) {
 
 func BenchmarkVBF3RedisAdvanceGeneration(b *testing.B) {
 	c := newTestRedisClient(b)
-	rf := NewVBF3Redis(c, b.Name(), 10*1000, 7)
+	rf := NewVBF3Redis(c, b.Name(), 10*1000, 7, WithAutoSweep())
 	ctx := context.Background()
 	err := rf.Prepare(ctx, 10)
 	if err != nil {
@@ -230,7 +232,7 @@ func testVBF3RedisTopBottom(ctx context.Context, t *testing.T, rf *VBF3Redis, bo
 
 func TestVBF3RedisAdvanceGeneration(t *testing.T) {
 	c := newTestRedisClient(t)
-	rf := NewVBF3Redis(c, t.Name(), 256, 1)
+	rf := NewVBF3Redis(c, t.Name(), 256, 1, WithAutoSweep())
 	ctx := context.Background()
 	err := rf.Prepare(ctx, 1)
 	if err != nil {
@@ -257,3 +259,522 @@ func TestVBF3RedisAdvanceGeneration(t *testing.T) {
 	rf.AdvanceGeneration(ctx, 1)
 	testVBF3RedisTopBottom(ctx, t, rf, 1, 1)
 }
+
+func TestVBF3RedisHash(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7, WithHash(XXHash{}))
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+
+	// other hash should fail loudly.
+	for _, rf2 := range []*VBF3Redis{
+		NewVBF3Redis(c, t.Name(), 1000, 7),
+		NewVBF3Redis(c, t.Name(), 1000, 7, WithHash(FNV{})),
+	} {
+		_, err := rf2.Check(ctx, []byte("foo"))
+		if err == nil {
+			t.Errorf("check with hash=%s should fail", rf2.ix.Name())
+		}
+		err = rf2.Prepare(ctx, 10)
+		if err == nil {
+			t.Errorf("prepare with hash=%s should fail", rf2.ix.Name())
+		}
+	}
+}
+
+func TestVBF3RedisDoubleHashing(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7, WithDoubleHashing())
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+	_, err = NewVBF3Redis(c, t.Name(), 1000, 7).Check(ctx, []byte("foo"))
+	if err == nil {
+		t.Error("check without double hashing should fail")
+	}
+}
+
+func TestVBF3RedisSeed(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	// a seed over 2^53, which can't be represented by numbers of Lua.
+	const seed = 1<<60 + 1
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7, WithSeed(seed))
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	_, err = rf.CheckAndPut(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+
+	// other seed should fail loudly.
+	for _, rf2 := range []*VBF3Redis{
+		NewVBF3Redis(c, t.Name(), 1000, 7),
+		NewVBF3Redis(c, t.Name(), 1000, 7, WithSeed(seed+1)),
+	} {
+		_, err := rf2.Check(ctx, []byte("foo"))
+		if err == nil {
+			t.Errorf("check with seed=%d should fail", rf2.ix.Seed)
+		}
+		_, err = rf2.CheckAndPut(ctx, []byte("foo"), 10)
+		if err == nil {
+			t.Errorf("check and put with seed=%d should fail", rf2.ix.Seed)
+		}
+		err = rf2.PutAll(ctx, 10, [][]byte{[]byte("foo")})
+		if err == nil {
+			t.Errorf("put all with seed=%d should fail", rf2.ix.Seed)
+		}
+	}
+}
+
+func TestVBF3RedisWraparound(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7)
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+
+	// 245 generations are safe, but 246th resurrects "foo".
+	err = rf.AdvanceGeneration(ctx, 245)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	var werr *WraparoundError
+	if !errors.As(err, &werr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if werr.MaxLife != 10 || werr.Advanced != 245 || werr.Generations != 1 {
+		t.Errorf("unexpected error: %+v", werr)
+	}
+	testVBF3RedisTopBottom(ctx, t, rf, 246, 255)
+
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance after sweep failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if has {
+		t.Error("foo is resurrected")
+	}
+}
+
+// countVBF3RedisInvalids counts non-zero registers which are not valid.
+func countVBF3RedisInvalids(ctx context.Context, t *testing.T, rf *VBF3Redis) int {
+	t.Helper()
+	gen, err := rf.getGen(ctx, rf.c)
+	if err != nil {
+		t.Fatalf("failed to get generation: %s", err)
+	}
+	b, err := rf.c.Get(ctx, rf.keyData).Bytes()
+	if err != nil {
+		t.Fatalf("failed to get data: %s", err)
+	}
+	n := 0
+	for _, v := range b {
+		if v != 0 && !gen.isValid(v) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestVBF3RedisSweepWithPut(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 200000, 7)
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	// registers to be expired, over multiple chunks.
+	err = c.BitField(ctx, rf.keyData, "SET", "u8", "#10", 1, "SET", "u8", "#100000", 1, "SET", "u8", "#199999", 1).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			err := rf.Put(ctx, []byte(strconv.Itoa(i)), 10)
+			if err != nil {
+				t.Errorf("put failed: %s", err)
+				return
+			}
+		}
+	}()
+	// sweep repeatedly while putting, it never fails by conflicts.
+	for i := 0; i < 5; i++ {
+		err := rf.Sweep(ctx)
+		if err != nil {
+			t.Errorf("sweep failed: %s", err)
+		}
+	}
+	wg.Wait()
+
+	if n := countVBF3RedisInvalids(ctx, t, rf); n != 0 {
+		t.Errorf("%d invalid registers remain", n)
+	}
+	for i := 0; i < 500; i++ {
+		has, err := rf.Check(ctx, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if !has {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+	gen, err := rf.getGen(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to get generation: %s", err)
+	}
+	if gen.Advanced == nil || *gen.Advanced != 0 {
+		t.Errorf("unexpected advanced: %v", gen.Advanced)
+	}
+}
+
+func TestVBF3RedisSweepStep(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 10000, 7)
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	err = c.BitField(ctx, rf.keyData, "SET", "u8", "#9999", 5).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	// interrupt a sweep at 3000.
+	for i := 0; i < 3; i++ {
+		done, err := rf.SweepStep(ctx, 1000)
+		if err != nil {
+			t.Fatalf("sweep step failed: %s", err)
+		}
+		if done {
+			t.Fatal("sweep should not be done")
+		}
+	}
+	// generations advanced while sweeping are counted.
+	err = rf.AdvanceGeneration(ctx, 2)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	// put expired registers before and after the cursor.
+	err = c.BitField(ctx, rf.keyData, "SET", "u8", "#10", 1, "SET", "u8", "#5000", 1).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	// other instances resume the sweep.
+	err = NewVBF3Redis(c, t.Name(), 10000, 7).Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	vals, err := c.BitField(ctx, rf.keyData, "GET", "u8", "#10", "GET", "u8", "#5000").Result()
+	if err != nil {
+		t.Fatalf("failed to get registers: %s", err)
+	}
+	if vals[0] != 1 || vals[1] != 0 {
+		t.Errorf("unexpected registers after resumed sweep: %+v", vals)
+	}
+	n, err := c.Exists(ctx, rf.keySweep).Result()
+	if err != nil {
+		t.Fatalf("failed to check cursor: %s", err)
+	}
+	if n != 0 {
+		t.Error("cursor should be removed after sweep")
+	}
+	gen, err := rf.getGen(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to get generation: %s", err)
+	}
+	if gen.Advanced == nil || *gen.Advanced != 2 {
+		t.Errorf("unexpected advanced: %v", gen.Advanced)
+	}
+
+	for _, s := range []string{"", "5000", "-1:1", "0:0", "0:256", "x:y"} {
+		err := c.Set(ctx, rf.keySweep, s, 0).Err()
+		if err != nil {
+			t.Fatalf("failed to setup: %s", err)
+		}
+		if _, err := rf.SweepStep(ctx, 1000); err == nil {
+			t.Errorf("sweep step should fail with cursor %q", s)
+		}
+	}
+	if _, err := rf.SweepStep(ctx, 0); err == nil {
+		t.Error("sweep step with zero size should fail")
+	}
+}
+
+func TestVBF3RedisWraparoundAutoSweep(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7, WithAutoSweep())
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 255)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	testVBF3RedisTopBottom(ctx, t, rf, 1, 10)
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if has {
+		t.Error("foo is resurrected")
+	}
+}
+
+func TestVBF3RedisWraparoundLegacy(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7)
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	// generation info without "advanced", which was created by old version.
+	err := c.Set(ctx, rf.keyGen, `{"bottom":1,"top":10,"max":10}`, 0).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	// an expired register, which should be swept before advancing.
+	err = c.BitField(ctx, rf.keyData, "SET", "u8", "#100", 200).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	v, err := c.BitField(ctx, rf.keyData, "GET", "u8", "#100").Result()
+	if err != nil {
+		t.Fatalf("failed to get register: %s", err)
+	}
+	if v[0] != 0 {
+		t.Errorf("expired register should be swept: %d", v[0])
+	}
+	gen, err := rf.getGen(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to get generation: %s", err)
+	}
+	if gen.Advanced == nil || *gen.Advanced != 1 {
+		t.Errorf("unexpected advanced: %v", gen.Advanced)
+	}
+}
+
+func TestVBF3RedisCheckAndPut(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 1000, 7, WithDoubleHashing())
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	for i, tc := range []struct {
+		life uint8
+		want bool
+	}{
+		{1, false},
+		{1, true},
+		{3, true},
+	} {
+		got, err := rf.CheckAndPut(ctx, []byte("foo"), tc.life)
+		if err != nil {
+			t.Fatalf("#%d check and put failed: %s", i, err)
+		}
+		if got != tc.want {
+			t.Errorf("#%d unexpected check and put: want=%t got=%t", i, tc.want, got)
+		}
+	}
+	err = rf.AdvanceGeneration(ctx, 3)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	got, err := rf.CheckAndPut(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	if got {
+		t.Error("foo should be expired")
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("foo should be put again")
+	}
+
+	_, err = rf.CheckAndPut(ctx, []byte("foo"), 11)
+	if err == nil {
+		t.Error("check and put over max life should fail")
+	}
+	for _, rf2 := range []*VBF3Redis{
+		NewVBF3Redis(c, t.Name(), 1000, 7),
+		NewVBF3Redis(c, t.Name(), 1000, 7, WithHash(FNV{}), WithDoubleHashing()),
+	} {
+		_, err := rf2.CheckAndPut(ctx, []byte("foo"), 1)
+		if err == nil {
+			t.Errorf("check and put with other hash should fail")
+		}
+	}
+}
+
+func TestVBF3RedisPutAllCheckAll(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf := NewVBF3Redis(c, t.Name(), 100000, 7)
+	err := rf.Prepare(ctx, 10)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Delete(ctx)
+	})
+	// enough data to split BITFIELD in the script.
+	var put, all [][]byte
+	for i := 0; i < 3000; i++ {
+		d := []byte(strconv.Itoa(i))
+		if i%2 == 0 {
+			put = append(put, d, d)
+		}
+		all = append(all, d)
+	}
+	err = rf.PutAll(ctx, 2, put)
+	if err != nil {
+		t.Fatalf("put all failed: %s", err)
+	}
+	err = rf.PutAll(ctx, 1, put[:10])
+	if err != nil {
+		t.Fatalf("put all failed: %s", err)
+	}
+	for n := 0; n < 3; n++ {
+		rr, err := rf.CheckAll(ctx, all)
+		if err != nil {
+			t.Fatalf("check all failed: %s", err)
+		}
+		if len(rr) != len(all) {
+			t.Fatalf("unexpected number of results: want=%d got=%d", len(all), len(rr))
+		}
+		for i, d := range all {
+			want, err := rf.Check(ctx, d)
+			if err != nil {
+				t.Fatalf("check failed: %s", err)
+			}
+			if rr[i] != want {
+				t.Errorf("result mismatch for %s after %d generations: want=%t got=%t", d, n, want, rr[i])
+			}
+			// shorter life doesn't overwrite longer one.
+			if i%2 == 0 && rr[i] != (n < 2) {
+				t.Errorf("unexpected result for %s after %d generations: %t", d, n, rr[i])
+			}
+		}
+		err = rf.AdvanceGeneration(ctx, 1)
+		if err != nil {
+			t.Fatalf("advance failed: %s", err)
+		}
+	}
+
+	err = NewVBF3Redis(c, t.Name(), 100000, 7, WithHash(FNV{})).PutAll(ctx, 1, put)
+	if err == nil {
+		t.Error("put all with other hash should fail")
+	}
+	_, err = NewVBF3Redis(c, t.Name(), 100000, 7, WithHash(FNV{})).CheckAll(ctx, all)
+	if err == nil {
+		t.Error("check all with other hash should fail")
+	}
+	_, err = NewVBF3Redis(c, t.Name()+"_none", 100000, 7).CheckAll(ctx, all)
+	if err == nil {
+		t.Error("check all without generation should fail")
+	}
+}
@@ -1,6 +1,7 @@
 package bloomfilter
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 )
@@ -49,7 +50,7 @@ func TestVBF3currLife(t *testing.T) {
 					t.Fatalf("unexpected life at bottom=%d top=%d data[%d]=%d: want=%d got=%d", f.bottom, f.top, j, f.data[j], want, got)
 				}
 			}
-			f.AdvanceGeneration(1)
+			f.rotate(1)
 		}
 	}
 }
@@ -187,14 +188,20 @@ func TestVBF3EvaporateWrap(t *testing.T) {
 			f.Put([]byte(strconv.Itoa(j)), uint8(j))
 		}
 
-		f.AdvanceGeneration(255)
-		f.AdvanceGeneration(uint8(i))
+		err := f.AdvanceGeneration(255)
+		if err != nil {
+			t.Fatalf("advance failed: %s", err)
+		}
+		err = f.AdvanceGeneration(uint8(i))
+		if err != nil {
+			t.Fatalf("advance failed: %s", err)
+		}
 
+		// all data should be expired, they must not come back by wraparound.
 		for j := 1; j <= 64; j++ {
-			want := j > i
 			got := f.Check([]byte(strconv.Itoa(j)))
-			if got != want {
-				t.Errorf("mismatch i=%d j=%d want=%t got=%t", i, j, want, got)
+			if got {
+				t.Errorf("resurrected i=%d j=%d", i, j)
 			}
 		}
 		if t.Failed() {
@@ -202,3 +209,112 @@ func TestVBF3EvaporateWrap(t *testing.T) {
 		}
 	}
 }
+
+func TestVBF3Wraparound(t *testing.T) {
+	for _, maxLife := range []uint8{1, 10, 64, 254} {
+		f := NewVBF3(1000, 7, maxLife)
+		f.Put([]byte("foo"), 1)
+		f.Put([]byte("bar"), maxLife)
+		// without Check nor Sweep, expired registers are left.
+		for i := 1; i <= 255*2; i++ {
+			err := f.AdvanceGeneration(1)
+			if err != nil {
+				t.Fatalf("advance failed: max=%d i=%d: %s", maxLife, i, err)
+			}
+			if i >= int(maxLife) && f.Check([]byte("bar")) {
+				t.Fatalf("bar is resurrected: max=%d i=%d", maxLife, i)
+			}
+			c := *f
+			c.data = append([]byte(nil), f.data...)
+			if c.Check([]byte("foo")) {
+				t.Fatalf("foo is resurrected: max=%d i=%d", maxLife, i)
+			}
+		}
+	}
+}
+
+func TestVBF3WraparoundRotate(t *testing.T) {
+	// rotate doesn't sweep: this is the false positive which AdvanceGeneration
+	// prevents.
+	f := NewVBF3(1000, 7, 10)
+	f.Put([]byte("foo"), 1)
+	f.rotate(1)
+	c := *f
+	c.data = append([]byte(nil), f.data...)
+	if c.Check([]byte("foo")) {
+		t.Fatal("foo should be expired")
+	}
+	f.rotate(245)
+	if !f.Check([]byte("foo")) {
+		t.Fatal("foo should be resurrected by rotate")
+	}
+}
+
+func TestVBF3WraparoundError(t *testing.T) {
+	f := NewVBF3(1000, 7, 255)
+	f.Put([]byte("foo"), 1)
+	err := f.AdvanceGeneration(1)
+	var werr *WraparoundError
+	if !errors.As(err, &werr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if werr.MaxLife != 255 || werr.Advanced != 0 || werr.Generations != 1 {
+		t.Errorf("unexpected error: %+v", werr)
+	}
+	testTopBottom(t, f, 1, 255)
+	if err := f.AdvanceGeneration(0); err != nil {
+		t.Errorf("advance 0 should succeed: %s", err)
+	}
+}
+
+func TestVBF3WraparoundUnmarshal(t *testing.T) {
+	f := NewVBF3(1000, 7, 10)
+	f.Put([]byte("foo"), 1)
+	f.rotate(1)
+	b, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed: %s", err)
+	}
+	f2 := &VBF3{}
+	err = f2.UnmarshalBinary(b)
+	if err != nil {
+		t.Fatalf("unmarshal failed: %s", err)
+	}
+	// f2 doesn't know advanced generations, it should sweep at first.
+	err = f2.AdvanceGeneration(245)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	if f2.Check([]byte("foo")) {
+		t.Fatal("foo is resurrected")
+	}
+}
+
+func TestVBF3CheckAndPut(t *testing.T) {
+	f := NewVBF3(1000, 7, 10)
+	for i, tc := range []struct {
+		life int
+		want bool
+	}{
+		{1, false},
+		{1, true},
+		{3, true},
+	} {
+		got := f.CheckAndPut([]byte("foo"), uint8(tc.life))
+		if got != tc.want {
+			t.Errorf("#%d unexpected check and put: want=%t got=%t", i, tc.want, got)
+		}
+	}
+	// longer life is kept.
+	f.AdvanceGeneration(2)
+	if !f.Check([]byte("foo")) {
+		t.Fatal("foo should be kept for longer life")
+	}
+	f.AdvanceGeneration(1)
+	if f.CheckAndPut([]byte("foo"), 1) {
+		t.Fatal("foo should be expired")
+	}
+	if !f.Check([]byte("foo")) {
+		t.Fatal("foo should be put again")
+	}
+}
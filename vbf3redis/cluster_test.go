@@ -0,0 +1,140 @@
+package vbf3redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func checkExists(ctx context.Context, t *testing.T, c redis.Cmdable, want int64, keys ...string) {
+	t.Helper()
+	n, err := c.Exists(ctx, keys...).Result()
+	if err != nil {
+		t.Fatalf("failed to check existence: %s", err)
+	}
+	if n != want {
+		t.Errorf("unexpected number of existing keys: want=%d got=%d keys=%q", want, n, keys)
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	name := t.Name()
+	rf, err := Open(ctx, c, name, 1000, 7, 10, WithHashTag())
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		Drop(ctx, c, name)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+
+	tagged := []string{"{" + name + "}_props", "{" + name + "}_gen", "{" + name + "}_0"}
+	checkExists(ctx, t, c, 3, tagged...)
+	checkExists(ctx, t, c, 0, name+"_props", name+"_gen", name+"_0")
+	for _, k := range tagged {
+		if slot, want := redisSlot(k), redisSlot(name); slot != want {
+			t.Errorf("key %q is in slot %d, want %d", k, slot, want)
+		}
+	}
+
+	_, err = Open(ctx, c, name, 1000, 7, 10)
+	if err == nil {
+		t.Error("open with other key layout should fail")
+	}
+	_, err = Open(ctx, c, name, 1000, 7, 10, WithHashTag())
+	if err != nil {
+		t.Errorf("open with same key layout failed: %s", err)
+	}
+}
+
+func TestHashTagOtherLayout(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	name := t.Name()
+	_, err := Open(ctx, c, name, 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		Drop(ctx, c, name)
+	})
+	_, err = Open(ctx, c, name, 1000, 7, 10, WithHashTag())
+	if err == nil {
+		t.Error("open with other key layout should fail")
+	}
+}
+
+func TestDrop(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	for _, hashTag := range []bool{false, true} {
+		name := t.Name()
+		var opts []Option
+		if hashTag {
+			opts = append(opts, WithHashTag())
+		}
+		rf, err := Open(ctx, c, name, 1000, 7, 10, opts...)
+		if err != nil {
+			t.Fatalf("failed to create: %s", err)
+		}
+		err = rf.Put(ctx, []byte("foo"), 10)
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+		key := newKeyBase(name, hashTag)
+		keys := []string{key.props(), key.gen(), key.data(0)}
+		checkExists(ctx, t, c, 3, keys...)
+		n, err := Drop(ctx, c, name)
+		if err != nil {
+			t.Fatalf("drop failed: %s", err)
+		}
+		if n != 3 {
+			t.Errorf("unexpected number of removed keys: want=3 got=%d", n)
+		}
+		checkExists(ctx, t, c, 0, keys...)
+	}
+}
+
+// redisSlot computes a hash slot of Redis Cluster for key.
+func redisSlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key) % 16384)
+}
+
+// crc16 is CRC16-CCITT (XMODEM), which is used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
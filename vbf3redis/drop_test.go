@@ -0,0 +1,91 @@
+package vbf3redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestKeyBaseOwns(t *testing.T) {
+	kb := newKeyBase("foo", false)
+	for _, tc := range []struct {
+		key  string
+		want bool
+	}{
+		{"foo_props", true},
+		{"foo_gen", true},
+		{"foo_sweep", true},
+		{"foo_lease", true},
+		{"foo_0", true},
+		{"foo_12", true},
+		{"foo_", false},
+		{"foo_x", false},
+		{"foo_1_0", false},
+		{"foo_bar_props", false},
+		{"foo_bar_gen", false},
+		{"foobar_0", false},
+		{"{foo}_0", false},
+	} {
+		if got := kb.owns(tc.key); got != tc.want {
+			t.Errorf("owns(%q): want=%t got=%t", tc.key, tc.want, got)
+		}
+	}
+}
+
+func TestDropScan(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	name := t.Name() + "*[x]?"
+	other := name + "_1"
+	rf, err := Open(ctx, c, other, 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	// keys without properties, which are found by SCAN.
+	key := newKeyBase(name, false)
+	keys := []string{key.gen(), key.data(0), key.data(1), key.data(2)}
+	for _, k := range keys {
+		err := c.Set(ctx, k, "x", 0).Err()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a key which matches with an unescaped pattern.
+	decoy := t.Name() + "a[x]b_0"
+	err = c.Set(ctx, decoy, "x", 0).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Del(ctx, decoy)
+	})
+
+	n, err := Drop(ctx, c, name)
+	if err != nil {
+		t.Fatalf("drop failed: %s", err)
+	}
+	if n != len(keys) {
+		t.Errorf("unexpected number of removed keys: want=%d got=%d", len(keys), n)
+	}
+	checkExists(ctx, t, c, 0, keys...)
+	checkExists(ctx, t, c, 1, decoy)
+	otherKey := newKeyBase(other, false)
+	checkExists(ctx, t, c, 3, otherKey.props(), otherKey.gen(), otherKey.data(0))
+}
+
+func TestDropCanceled(t *testing.T) {
+	c := newTestRedisClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := Drop(ctx, c, t.Name())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("drop should fail with context.Canceled: %v", err)
+	}
+}
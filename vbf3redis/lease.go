@@ -0,0 +1,81 @@
+package vbf3redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Lease is an expiring lock of a filter on Redis, which implements
+// bloomfilter.Lease. It is used with bloomfilter.Scheduler to make only one
+// of processes advance generations of a shared filter.
+type Lease struct {
+	c     redis.UniversalClient
+	key   string
+	token string
+}
+
+// NewLease creates a Lease for the filter. Each Lease has a random token to
+// identify the holder.
+func (rf *VBF3Redis) NewLease() (*Lease, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate a token: %w", err)
+	}
+	return &Lease{
+		c:     rf.c,
+		key:   rf.key.lease(),
+		token: hex.EncodeToString(b[:]),
+	}, nil
+}
+
+// scriptAcquireLease extends the lease (KEYS[1]) when it is held by the token
+// (ARGV[1]), otherwise acquires it when no one holds. The lease expires after
+// ARGV[2] milliseconds.
+var scriptAcquireLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+  return 1
+end
+return 0
+`)
+
+// scriptReleaseLease releases the lease (KEYS[1]) when it is held by the
+// token (ARGV[1]).
+var scriptReleaseLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Acquire acquires the lease or extends it for ttl. It returns false when
+// other holds the lease.
+func (l *Lease) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		return false, fmt.Errorf("ttl should be 1ms or longer: %s", ttl)
+	}
+	r, err := scriptAcquireLease.Run(ctx, l.c, []string{l.key}, l.token, ms).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease %q: %w", l.key, err)
+	}
+	return r != 0, nil
+}
+
+// Release releases the lease when it is held.
+func (l *Lease) Release(ctx context.Context) error {
+	err := scriptReleaseLease.Run(ctx, l.c, []string{l.key}, l.token).Err()
+	if err != nil {
+		return fmt.Errorf("failed to release lease %q: %w", l.key, err)
+	}
+	return nil
+}
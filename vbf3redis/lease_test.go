@@ -0,0 +1,91 @@
+package vbf3redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/koron-go/bloomfilter"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	l1, err := rf.NewLease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := rf.NewLease()
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquire := func(l *Lease, want bool) {
+		t.Helper()
+		got, err := l.Acquire(ctx, time.Minute)
+		if err != nil {
+			t.Fatalf("acquire failed: %s", err)
+		}
+		if got != want {
+			t.Errorf("unexpected result of acquire: want=%t got=%t", want, got)
+		}
+	}
+	acquire(l1, true)
+	acquire(l2, false)
+	// extend
+	acquire(l1, true)
+	// release by other holder is ignored.
+	err = l2.Release(ctx)
+	if err != nil {
+		t.Fatalf("release failed: %s", err)
+	}
+	acquire(l2, false)
+	err = l1.Release(ctx)
+	if err != nil {
+		t.Fatalf("release failed: %s", err)
+	}
+	acquire(l2, true)
+	acquire(l1, false)
+}
+
+func TestSchedulerWithLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	// schedulers sweep rf by steps, renewing the lease.
+	var _ bloomfilter.StepSweeper = rf
+	var schedulers []*bloomfilter.Scheduler
+	for i := 0; i < 3; i++ {
+		l, err := rf.NewLease()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := bloomfilter.NewScheduler(rf, rf.MaxLife, time.Minute, l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schedulers = append(schedulers, s)
+	}
+	// only a holder of the lease advances generations.
+	for i := 0; i < 4; i++ {
+		for _, s := range schedulers {
+			err := s.Step(ctx)
+			if err != nil {
+				t.Fatalf("step failed: %s", err)
+			}
+		}
+	}
+	testVBF3RedisTopBottom(ctx, t, rf, 5, 14)
+}
@@ -0,0 +1,344 @@
+package vbf3redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/koron-go/bloomfilter"
+)
+
+// migrateChunkSize is number of registers which are copied by a script call
+// of Migrate.
+const migrateChunkSize = sweepChunkSize
+
+// getLegacyGen gets generation info of bloomfilter.VBF3Redis, which is stored
+// at "{name}_gen".
+func getLegacyGen(ctx context.Context, c redis.Cmdable, name string) (*bloomfilter.VBF3Gen, error) {
+	key := name + "_gen"
+	b, err := c.Get(ctx, key).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get generation info with key %q: %w", key, err)
+	}
+	var g *bloomfilter.VBF3Gen
+	err = json.Unmarshal(b, &g)
+	if err != nil {
+		return nil, fmt.Errorf("invalid format of generation info: %w", err)
+	}
+	return g, nil
+}
+
+// Migrate copies a filter of bloomfilter.VBF3Redis, which is stored at keys
+// "{from}" and "{from}_gen", to a filter with name to in the layout of this
+// package, and opens it.
+//
+// m and k should be the same as bloomfilter.VBF3Redis, and the hash, the seed
+// and double hashing should be specified by opts. They are verified with the
+// old generation info, except the seed of old versions which don't record it.
+// The max life is taken from the old generation info. Keys of both filters must not overlap, so from and
+// to should be different.
+//
+// Registers are merged into the new filter keeping longer remaining life, so
+// Migrate can run while both filters are updated by DualWriter. Generations of
+// both filters must be same while Migrate runs, so advance them only by
+// DualWriter.
+// Check the result with Verify, before switching to the new filter.
+func Migrate(ctx context.Context, c redis.UniversalClient, from, to string, m uint64, k uint, opts ...Option) (*VBF3Redis, error) {
+	o := newOptions(opts)
+	key := newKeyBase(to, o.hashTag)
+	if key.gen() == from+"_gen" || key.owns(from) {
+		return nil, fmt.Errorf("keys of %q overlap with the old filter %q", to, from)
+	}
+	old, err := getLegacyGen(ctx, c, from)
+	if err != nil {
+		return nil, err
+	}
+	ix := bloomfilter.Indexer{Hash: o.hash, DoubleHashing: o.doubleHashing}
+	oldHash := old.Hash
+	if oldHash == "" {
+		oldHash = bloomfilter.MetroHash{}.Name()
+	}
+	if oldHash != ix.Name() {
+		return nil, fmt.Errorf("hash mismatch: want=%q got=%q", ix.Name(), oldHash)
+	}
+	if old.DoubleHashing != o.doubleHashing {
+		return nil, fmt.Errorf("double hashing mismatch: want=%t got=%t", o.doubleHashing, old.DoubleHashing)
+	}
+	if old.Seed != o.seed {
+		// don't reveal seeds, they may be secrets.
+		return nil, errors.New("seed mismatch")
+	}
+	n, err := c.StrLen(ctx, from).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get length of %q: %w", from, err)
+	}
+	if uint64(n) > m {
+		return nil, fmt.Errorf("m is too small for the old filter: m=%d length=%d", m, n)
+	}
+
+	rf, err := Open(ctx, c, to, m, k, old.Max, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// Advanced of old versions is unknown (nil), then AdvanceGeneration sweeps
+	// the new filter once before advancing.
+	err = putGen(ctx, c, rf.key, &vbf3gen{
+		Bottom:   old.Bottom,
+		Top:      old.Top,
+		Advanced: old.Advanced,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for off := int64(0); off < n; off += migrateChunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		b, err := c.GetRange(ctx, from, off, off+migrateChunkSize-1).Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get registers of %q at %d: %w", from, off, err)
+		}
+		if isZeros(b) {
+			continue
+		}
+		page := int(uint64(off) / pageSize)
+		keys := []string{rf.key.gen(), rf.key.data(page)}
+		err = scriptMerge.Run(ctx, c, keys, uint64(off)%pageSize, b).Err()
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge registers to %q at %d: %w", rf.key.data(page), off, err)
+		}
+	}
+	return rf, nil
+}
+
+func isZeros(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// verifyProbes is number of items which Verify puts and checks through both
+// filters.
+const verifyProbes = 16
+
+// Verify compares validity of registers at random samples of positions, between
+// the filter and an old filter of bloomfilter.VBF3Redis with name from.
+// Then it puts verifyProbes items with life 1 through both filters, and checks
+// them by indexes of the both, so the hash options are verified too.
+// It fails when generations of them differ, or any of samples and items
+// mismatch. When samples is not positive, it compares only generations.
+// Generations should not be advanced while Verify runs.
+func (rf *VBF3Redis) Verify(ctx context.Context, from string, samples int) error {
+	old, err := getLegacyGen(ctx, rf.c, from)
+	if err != nil {
+		return err
+	}
+	gen, err := getGen(ctx, rf.c, rf.key)
+	if err != nil {
+		return err
+	}
+	if old.Bottom != gen.Bottom || old.Top != gen.Top {
+		return fmt.Errorf("generation mismatch: old=%d~%d new=%d~%d", old.Bottom, old.Top, gen.Bottom, gen.Top)
+	}
+	if samples <= 0 {
+		return nil
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	xx := make([]uint64, samples)
+	oldArgs := make([]interface{}, 0, 3*samples)
+	newArgs := map[uint64][]interface{}{}
+	for i := range xx {
+		x := uint64(r.Int63n(int64(rf.M)))
+		xx[i] = x
+		oldArgs = append(oldArgs, "GET", "u8", x*8)
+		page := x / pageSize
+		newArgs[page] = append(newArgs[page], "GET", "u8", (x%pageSize)*8)
+	}
+	var oldCmd *redis.IntSliceCmd
+	newCmds := map[uint64]*redis.IntSliceCmd{}
+	_, err = rf.c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		oldCmd = pipe.BitField(ctx, from, oldArgs...)
+		for page, args := range newArgs {
+			newCmds[page] = pipe.BitField(ctx, rf.key.data(int(page)), args...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get samples: %w", err)
+	}
+	oldVals := oldCmd.Val()
+	next := map[uint64]int{}
+	var mismatches int
+	for i, x := range xx {
+		page := x / pageSize
+		v := newCmds[page].Val()[next[page]]
+		next[page]++
+		if gen.isValid(uint8(oldVals[i])) != gen.isValid(uint8(v)) {
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d samples mismatch", mismatches, samples)
+	}
+	return rf.verifyItems(ctx, from, gen)
+}
+
+// legacy returns an old filter with name from, which is configured with same
+// hash options as the filter.
+func (rf *VBF3Redis) legacy(from string) *bloomfilter.VBF3Redis {
+	opts := []bloomfilter.Option{
+		bloomfilter.WithHash(rf.ix.Hash),
+		bloomfilter.WithSeed(rf.ix.Seed),
+	}
+	if rf.ix.DoubleHashing {
+		opts = append(opts, bloomfilter.WithDoubleHashing())
+	}
+	return bloomfilter.NewVBF3Redis(rf.c, from, int(rf.M), int(rf.K), opts...)
+}
+
+// verifyItems puts probe items through both filters, then checks them with
+// each filter, and with registers of the old filter at indexes of the filter.
+func (rf *VBF3Redis) verifyItems(ctx context.Context, from string, gen *vbf3gen) error {
+	old := rf.legacy(from)
+	prefix := "vbf3redis.Verify:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":"
+	var mismatches int
+	for i := 0; i < verifyProbes; i++ {
+		d := []byte(prefix + strconv.Itoa(i))
+		err := old.Put(ctx, d, 1)
+		if err != nil {
+			return fmt.Errorf("failed to put a probe to the old filter: %w", err)
+		}
+		err = rf.Put(ctx, d, 1)
+		if err != nil {
+			return fmt.Errorf("failed to put a probe: %w", err)
+		}
+		hasOld, err := old.Check(ctx, d)
+		if err != nil {
+			return fmt.Errorf("failed to check a probe in the old filter: %w", err)
+		}
+		has, err := rf.Check(ctx, d)
+		if err != nil {
+			return fmt.Errorf("failed to check a probe: %w", err)
+		}
+		cross, err := rf.checkLegacy(ctx, from, gen, d)
+		if err != nil {
+			return err
+		}
+		if !hasOld || !has || !cross {
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d probe items mismatch", mismatches, verifyProbes)
+	}
+	return nil
+}
+
+// checkLegacy checks a data with registers of the old filter with name from,
+// at indexes of the filter.
+func (rf *VBF3Redis) checkLegacy(ctx context.Context, from string, gen *vbf3gen, d []byte) (bool, error) {
+	xx := rf.ix.Indexes(nil, d, int(rf.K), rf.M)
+	args := make([]interface{}, 0, 3*len(xx))
+	for _, x := range xx {
+		args = append(args, "GET", "u8", x*8)
+	}
+	vals, err := rf.c.BitField(ctx, from, args...).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to get registers of %q: %w", from, err)
+	}
+	for _, v := range vals {
+		if !gen.isValid(uint8(v)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// DualWriter updates both of an old filter of bloomfilter.VBF3Redis and a new
+// filter, while migration. Check reads the old filter, which is the source of
+// truth until the new filter is verified.
+type DualWriter struct {
+	from *bloomfilter.VBF3Redis
+	to   *VBF3Redis
+}
+
+// NewDualWriter creates a DualWriter for an old filter and a new filter which
+// is migrated from it.
+func NewDualWriter(from *bloomfilter.VBF3Redis, to *VBF3Redis) *DualWriter {
+	return &DualWriter{from: from, to: to}
+}
+
+// Put puts a value with life to both filters.
+func (dw *DualWriter) Put(ctx context.Context, d []byte, life uint8) error {
+	err := dw.from.Put(ctx, d, life)
+	if err != nil {
+		return err
+	}
+	return dw.to.Put(ctx, d, life)
+}
+
+// PutAll puts all values with life to both filters.
+func (dw *DualWriter) PutAll(ctx context.Context, life uint8, dd [][]byte) error {
+	err := dw.from.PutAll(ctx, life, dd)
+	if err != nil {
+		return err
+	}
+	return dw.to.PutAll(ctx, life, dd)
+}
+
+// Check checks a value in the old filter.
+func (dw *DualWriter) Check(ctx context.Context, d []byte) (bool, error) {
+	return dw.from.Check(ctx, d)
+}
+
+// CheckAll checks values in the old filter.
+func (dw *DualWriter) CheckAll(ctx context.Context, dd [][]byte) ([]bool, error) {
+	return dw.from.CheckAll(ctx, dd)
+}
+
+// CheckAndPut checks a value in the old filter and puts it to both filters.
+func (dw *DualWriter) CheckAndPut(ctx context.Context, d []byte, life uint8) (bool, error) {
+	r, err := dw.from.CheckAndPut(ctx, d, life)
+	if err != nil {
+		return false, err
+	}
+	err = dw.to.Put(ctx, d, life)
+	if err != nil {
+		return false, err
+	}
+	return r, nil
+}
+
+// AdvanceGeneration advances generations of both filters. When the new filter
+// fails to advance after the old one, generations of filters differ. Then
+// migrate again after fixing the cause.
+func (dw *DualWriter) AdvanceGeneration(ctx context.Context, generations uint8) error {
+	err := dw.from.AdvanceGeneration(ctx, generations)
+	if err != nil {
+		return err
+	}
+	err = dw.to.AdvanceGeneration(ctx, generations)
+	if err != nil {
+		return fmt.Errorf("only the old filter is advanced: %w", err)
+	}
+	return nil
+}
+
+// Sweep sweeps both filters.
+func (dw *DualWriter) Sweep(ctx context.Context) error {
+	err := dw.from.Sweep(ctx)
+	if err != nil {
+		return err
+	}
+	return dw.to.Sweep(ctx)
+}
@@ -0,0 +1,195 @@
+package vbf3redis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/koron-go/bloomfilter"
+)
+
+func newTestLegacyVBF3Redis(ctx context.Context, t *testing.T, name string, m, k int, maxLife uint8, opts ...bloomfilter.Option) *bloomfilter.VBF3Redis {
+	t.Helper()
+	c := newTestRedisClient(t)
+	old := bloomfilter.NewVBF3Redis(c, name, m, k, opts...)
+	err := old.Prepare(ctx, maxLife)
+	if err != nil {
+		t.Fatalf("failed to prepare: %s", err)
+	}
+	t.Cleanup(func() {
+		old.Delete(ctx)
+	})
+	return old
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	from := t.Name() + "_old"
+	old := newTestLegacyVBF3Redis(ctx, t, from, 100000, 7, 10, bloomfilter.WithSeed(123), bloomfilter.WithDoubleHashing())
+	var all [][]byte
+	for i := 0; i < 1000; i++ {
+		d := []byte(strconv.Itoa(i))
+		err := old.Put(ctx, d, uint8(i%10+1))
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+		all = append(all, d)
+	}
+	err := old.AdvanceGeneration(ctx, 3)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+
+	rf, err := Migrate(ctx, c, from, t.Name(), 100000, 7, WithSeed(123), WithDoubleHashing())
+	if err != nil {
+		t.Fatalf("migrate failed: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	if rf.MaxLife != 10 {
+		t.Errorf("max life mismatch: want=10 got=%d", rf.MaxLife)
+	}
+	err = rf.Verify(ctx, from, 10000)
+	if err != nil {
+		t.Fatalf("verify failed: %s", err)
+	}
+	// probe items are put and checked with hash options of the filter.
+	rf2 := *rf
+	rf2.ix.Seed = 456
+	err = rf2.Verify(ctx, from, 10000)
+	if err == nil {
+		t.Error("verify with other seed should fail")
+	}
+	want, err := old.CheckAll(ctx, all)
+	if err != nil {
+		t.Fatalf("check all failed: %s", err)
+	}
+	got, err := rf.CheckAll(ctx, all)
+	if err != nil {
+		t.Fatalf("check all failed: %s", err)
+	}
+	for i := range all {
+		if got[i] != want[i] {
+			t.Errorf("check mismatch for %d: want=%t got=%t", i, want[i], got[i])
+		}
+		if i%10 >= 3 && !got[i] {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+
+	// generations are shared by DualWriter.
+	dw := NewDualWriter(old, rf)
+	err = dw.AdvanceGeneration(ctx, 2)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	err = rf.Verify(ctx, from, 10000)
+	if err != nil {
+		t.Fatalf("verify after advance failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	err = rf.Verify(ctx, from, 0)
+	if err == nil {
+		t.Error("verify should fail for different generations")
+	}
+}
+
+func TestMigrateDualWriter(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	from := t.Name() + "_old"
+	old := newTestLegacyVBF3Redis(ctx, t, from, 100000, 7, 10)
+	for i := 0; i < 500; i++ {
+		err := old.Put(ctx, []byte(strconv.Itoa(i)), 10)
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	// prepare the new filter to start dual writes before migration.
+	rf, err := Open(ctx, c, t.Name(), 100000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	dw := NewDualWriter(old, rf)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 500; i < 1000; i++ {
+			err := dw.Put(ctx, []byte(strconv.Itoa(i)), 10)
+			if err != nil {
+				t.Errorf("dual put failed: %s", err)
+				return
+			}
+		}
+	}()
+	_, err = Migrate(ctx, c, from, t.Name(), 100000, 7)
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("migrate failed: %s", err)
+	}
+	err = rf.Verify(ctx, from, 10000)
+	if err != nil {
+		t.Fatalf("verify failed: %s", err)
+	}
+	for i := 0; i < 1000; i++ {
+		has, err := rf.Check(ctx, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if !has {
+			t.Errorf("false negative for %d", i)
+		}
+	}
+	seen, err := dw.CheckAndPut(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	if seen {
+		t.Error("foo should not be seen")
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("foo should be put to the new filter")
+	}
+}
+
+func TestMigrateMismatch(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	from := t.Name() + "_old"
+	newTestLegacyVBF3Redis(ctx, t, from, 1000, 7, 10, bloomfilter.WithHash(bloomfilter.XXHash{}))
+	for i, tc := range []struct {
+		to   string
+		m    uint64
+		opts []Option
+	}{
+		{t.Name(), 1000, nil},
+		{t.Name(), 1000, []Option{WithHash(bloomfilter.XXHash{}), WithDoubleHashing()}},
+		{from, 1000, []Option{WithHash(bloomfilter.XXHash{})}},
+		{t.Name(), 1000, []Option{WithHash(bloomfilter.XXHash{}), WithSeed(1)}},
+	} {
+		_, err := Migrate(ctx, c, from, tc.to, tc.m, 7, tc.opts...)
+		if err == nil {
+			t.Errorf("#%d migrate should fail", i)
+		}
+	}
+	_, err := Migrate(ctx, c, t.Name()+"_none", t.Name(), 1000, 7)
+	if err == nil {
+		t.Error("migrate without old filter should fail")
+	}
+	checkExists(ctx, t, c, 0, newKeyBase(t.Name(), false).props())
+}
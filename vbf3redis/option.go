@@ -0,0 +1,73 @@
+package vbf3redis
+
+import "github.com/koron-go/bloomfilter"
+
+// Option configures VBF3Redis which is opened by Open.
+type Option func(*options)
+
+type options struct {
+	hash          bloomfilter.Hash64
+	seed          uint64
+	doubleHashing bool
+	hashTag       bool
+	autoSweep     bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithHash specifies a family of hash functions.
+// Its name is recorded in properties, so the filter must be opened with same
+// hash always.
+func WithHash(h bloomfilter.Hash64) Option {
+	return func(o *options) {
+		o.hash = h
+	}
+}
+
+// WithDoubleHashing enables double hashing, which derives k indexes from one
+// 128-bit hash. It is recorded in properties, so existing filters which were
+// created without it keep working.
+func WithDoubleHashing() Option {
+	return func(o *options) {
+		o.doubleHashing = true
+	}
+}
+
+// WithSeed specifies base of seeds for hash functions. It is mixed into every
+// index computation, so filters with different seeds don't share collision
+// patterns. Use a secret seed against precomputed colliding data.
+// It is recorded in properties, so the filter must be opened with same seed
+// always.
+func WithSeed(seed uint64) Option {
+	return func(o *options) {
+		o.seed = seed
+	}
+}
+
+// WithHashTag enables key layout for Redis Cluster. All keys of the filter
+// are hash-tagged by name like "{name}_props", "{name}_gen" and "{name}_0",
+// so scripts and transactions which touch multiple keys work on a cluster.
+// Then all pages of the filter are stored in a node.
+// It is recorded in properties, and Open fails when the filter exists with
+// other key layout.
+func WithHashTag() Option {
+	return func(o *options) {
+		o.hashTag = true
+	}
+}
+
+// WithAutoSweep lets AdvanceGeneration sweep registers when advancing would
+// resurrect expired registers, instead of returning
+// bloomfilter.WraparoundError. The sweep may take long time for large
+// filters.
+func WithAutoSweep() Option {
+	return func(o *options) {
+		o.autoSweep = true
+	}
+}
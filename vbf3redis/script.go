@@ -0,0 +1,275 @@
+package vbf3redis
+
+import "github.com/go-redis/redis/v8"
+
+// Scripts are loaded by EVALSHA, and fall back to EVAL on NOSCRIPT (see
+// redis.Script.Run).
+//
+// KEYS and ARGV of scripts are composed by scriptArgs:
+//
+//	KEYS[1]       generation key
+//	KEYS[2..]     page keys
+//	ARGV[1..a-1]  script specific arguments
+//	ARGV[a..]     for each page: number of positions N, and N bit offsets
+
+// scriptLib is common functions for scripts.
+const scriptLib = `
+local function get_gen()
+  local s = redis.call('GET', KEYS[1])
+  if not s then
+    return nil
+  end
+  local g = cjson.decode(s)
+  return g['bottom'], g['top']
+end
+
+local function is_valid(bottom, top, n)
+  if n == 0 then
+    return false
+  end
+  if bottom <= top then
+    return bottom <= n and n <= top
+  end
+  return bottom <= n or n <= top
+end
+
+local function curr_life(bottom, top, n)
+  if not is_valid(bottom, top, n) then
+    return 0
+  end
+  local d = n - bottom + 1
+  if n < bottom then
+    d = d - 1
+  end
+  return d
+end
+
+-- bitfield calls BITFIELD with ops which have w arguments for each,
+-- splitting them to avoid too many arguments for unpack.
+local function bitfield(key, args, w)
+  local rv = {}
+  local step = w * 1000
+  for i = 1, #args, step do
+    local r = redis.call('BITFIELD', key, unpack(args, i, math.min(i + step - 1, #args)))
+    for _, v in ipairs(r) do
+      table.insert(rv, v)
+    end
+  end
+  return rv
+end
+
+-- each_page calls fn for each page with its key and offsets.
+local function each_page(a, fn)
+  for i = 2, #KEYS do
+    local n = tonumber(ARGV[a])
+    local offsets = {}
+    for j = 1, n do
+      offsets[j] = ARGV[a + j]
+    end
+    fn(KEYS[i], offsets)
+    a = a + n + 1
+  end
+end
+
+local function get_values(key, offsets)
+  local args = {}
+  for _, x in ipairs(offsets) do
+    table.insert(args, 'GET')
+    table.insert(args, 'u8')
+    table.insert(args, x)
+  end
+  return bitfield(key, args, 3)
+end
+
+local function set_values(key, offsets, v)
+  if #offsets == 0 then
+    return
+  end
+  local args = {}
+  for _, x in ipairs(offsets) do
+    table.insert(args, 'SET')
+    table.insert(args, 'u8')
+    table.insert(args, x)
+    table.insert(args, v)
+  end
+  bitfield(key, args, 4)
+end
+`
+
+// scriptPut puts positions with life (ARGV[1]).
+// Registers which have longer life are kept.
+var scriptPut = redis.NewScript(scriptLib + `
+local bottom, top = get_gen()
+if not bottom then
+  return redis.error_reply('no generation info: ' .. KEYS[1])
+end
+local life = tonumber(ARGV[1])
+local nv = bottom + life - 1
+if nv > 255 then
+  nv = nv - 255
+end
+each_page(2, function(key, offsets)
+  local vals = get_values(key, offsets)
+  local updates = {}
+  for j, v in ipairs(vals) do
+    local curr = curr_life(bottom, top, v)
+    if curr == 0 or life > curr then
+      table.insert(updates, offsets[j])
+    end
+  end
+  set_values(key, updates, nv)
+end)
+return 0
+`)
+
+// scriptCheckAndPut puts positions with life (ARGV[1]) like scriptPut, and
+// returns 1 when all positions were valid before (otherwise 0).
+var scriptCheckAndPut = redis.NewScript(scriptLib + `
+local bottom, top = get_gen()
+if not bottom then
+  return redis.error_reply('no generation info: ' .. KEYS[1])
+end
+local life = tonumber(ARGV[1])
+local nv = bottom + life - 1
+if nv > 255 then
+  nv = nv - 255
+end
+local rv = 1
+each_page(2, function(key, offsets)
+  local vals = get_values(key, offsets)
+  local updates = {}
+  for j, v in ipairs(vals) do
+    local curr = curr_life(bottom, top, v)
+    if curr == 0 then
+      rv = 0
+    end
+    if curr == 0 or life > curr then
+      table.insert(updates, offsets[j])
+    end
+  end
+  set_values(key, updates, nv)
+end)
+return rv
+`)
+
+// scriptCheck checks positions, and returns 1 (valid) or 0 (invalid) for
+// each position. Invalid registers are cleared.
+var scriptCheck = redis.NewScript(scriptLib + `
+local bottom, top = get_gen()
+if not bottom then
+  return redis.error_reply('no generation info: ' .. KEYS[1])
+end
+local rv = {}
+each_page(1, function(key, offsets)
+  local vals = get_values(key, offsets)
+  local invalids = {}
+  for j, v in ipairs(vals) do
+    if is_valid(bottom, top, v) then
+      table.insert(rv, 1)
+    else
+      table.insert(rv, 0)
+      if v ~= 0 then
+        table.insert(invalids, offsets[j])
+      end
+    end
+  end
+  set_values(key, invalids, 0)
+end)
+return rv
+`)
+
+// scriptSweep clears invalid registers in a chunk, and advances the cursor.
+//
+//	KEYS[1]  generation key
+//	KEYS[2]  page key
+//	KEYS[3]  sweep cursor key
+//	ARGV     page, number of pages, offset and size of the chunk, and bottom
+//	         generation when the sweep started (-1 for a new sweep)
+//
+// It returns number of cleared registers, and 1 when the sweep is done
+// (otherwise 0). When the sweep is done, "advanced" of the generation is
+// updated to generations advanced since the sweep started.
+var scriptSweep = redis.NewScript(scriptLib + `
+local bottom, top = get_gen()
+if not bottom then
+  return redis.error_reply('no generation info: ' .. KEYS[1])
+end
+local page, pages = tonumber(ARGV[1]), tonumber(ARGV[2])
+local off, size = tonumber(ARGV[3]), tonumber(ARGV[4])
+local start = tonumber(ARGV[5])
+if start < 0 then
+  start = bottom
+end
+local key = KEYS[2]
+local s = redis.call('GETRANGE', key, off, off + size - 1)
+local invalids = {}
+for i = 1, #s do
+  local v = string.byte(s, i)
+  if v ~= 0 and not is_valid(bottom, top, v) then
+    table.insert(invalids, (off + i - 1) * 8)
+  end
+end
+set_values(key, invalids, 0)
+off = off + size
+if off >= redis.call('STRLEN', key) then
+  page = page + 1
+  off = 0
+end
+if page >= pages then
+  redis.call('DEL', KEYS[3])
+  local g = cjson.decode(redis.call('GET', KEYS[1]))
+  g['advanced'] = (bottom - start) % 255
+  redis.call('SET', KEYS[1], cjson.encode(g))
+  return {#invalids, 1}
+end
+redis.call('SET', KEYS[3], page .. ':' .. off .. ':' .. start)
+return {#invalids, 0}
+`)
+
+// scriptMerge merges registers of a chunk (ARGV[2]) into a page (KEYS[2]) at
+// an offset (ARGV[1]), keeping registers which have longer life.
+// It returns number of updated registers.
+var scriptMerge = redis.NewScript(scriptLib + `
+local bottom, top = get_gen()
+if not bottom then
+  return redis.error_reply('no generation info: ' .. KEYS[1])
+end
+local off, src = tonumber(ARGV[1]), ARGV[2]
+local dst = redis.call('GETRANGE', KEYS[2], off, off + #src - 1)
+local args = {}
+for i = 1, #src do
+  local s = string.byte(src, i)
+  local d = string.byte(dst, i) or 0
+  if curr_life(bottom, top, s) > curr_life(bottom, top, d) then
+    table.insert(args, 'SET')
+    table.insert(args, 'u8')
+    table.insert(args, (off + i - 1) * 8)
+    table.insert(args, s)
+  end
+end
+local updated = #args / 4
+if updated > 0 then
+  bitfield(KEYS[2], args, 4)
+end
+return updated
+`)
+
+// scriptArgs composes KEYS and ARGV for scripts. Positions must be sorted by
+// pages.
+func (rf *VBF3Redis) scriptArgs(pp []pos, args ...interface{}) ([]string, []interface{}) {
+	keys := []string{rf.key.gen()}
+	for i := 0; i < len(pp); {
+		page := pp[i].page
+		n := 1
+		for i+n < len(pp) && pp[i+n].page == page {
+			n++
+		}
+		keys = append(keys, rf.key.data(int(page)))
+		args = append(args, n)
+		for _, p := range pp[i : i+n] {
+			args = append(args, p.index)
+		}
+		i += n
+	}
+	return keys, args
+}
@@ -0,0 +1,191 @@
+package vbf3redis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestScriptConcurrentPut(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+
+	// shorter lives must not overwrite longer one, in any order.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for life := uint8(1); life <= 10; life++ {
+			wg.Add(1)
+			go func(life uint8) {
+				defer wg.Done()
+				err := rf.Put(ctx, []byte("foo"), life)
+				if err != nil {
+					t.Errorf("put failed: %s", err)
+				}
+			}(life)
+		}
+	}
+	wg.Wait()
+
+	err = rf.AdvanceGeneration(ctx, 9)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("the longest life is lost")
+	}
+}
+
+func TestScriptNoScript(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = c.ScriptFlush(ctx).Err()
+	if err != nil {
+		t.Fatalf("failed to flush scripts: %s", err)
+	}
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	err = c.ScriptFlush(ctx).Err()
+	if err != nil {
+		t.Fatalf("failed to flush scripts: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+}
+
+func TestScriptLargeBatch(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	// too many positions for an unpack.
+	dd := make([][]byte, 1500)
+	for i := range dd {
+		dd[i] = []byte(strconv.Itoa(i))
+	}
+	err = rf.PutAll(ctx, 10, dd)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	rv, err := rf.CheckAll(ctx, dd)
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	for i, r := range rv {
+		if !r {
+			t.Fatalf("false negative at #%d", i)
+		}
+	}
+}
+
+func TestScriptNoGeneration(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = c.Del(ctx, rf.key.gen()).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rf.Put(ctx, []byte("foo"), 1); err == nil {
+		t.Error("put should fail without generation")
+	}
+	if _, err := rf.Check(ctx, []byte("foo")); err == nil {
+		t.Error("check should fail without generation")
+	}
+}
+
+func TestScriptCheckAndPut(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 7, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+
+	// each data is seen as new only once by concurrent processes.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	firsts := map[int]int{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				seen, err := rf.CheckAndPut(ctx, []byte(strconv.Itoa(j)), 2)
+				if err != nil {
+					t.Errorf("check and put failed: %s", err)
+					return
+				}
+				if !seen {
+					mu.Lock()
+					firsts[j]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for j, n := range firsts {
+		if n > 1 {
+			t.Errorf("%d is seen as new %d times", j, n)
+		}
+	}
+	if len(firsts) < 45 {
+		t.Errorf("too few new data: %d", len(firsts))
+	}
+
+	err = rf.AdvanceGeneration(ctx, 2)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	seen, err := rf.CheckAndPut(ctx, []byte("0"), 1)
+	if err != nil {
+		t.Fatalf("check and put failed: %s", err)
+	}
+	if seen {
+		t.Error("expired data is seen")
+	}
+	_, err = rf.CheckAndPut(ctx, []byte("0"), 11)
+	if err == nil {
+		t.Error("check and put over max life should fail")
+	}
+}
@@ -0,0 +1,248 @@
+package vbf3redis
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// countRegisters counts non-zero registers in the first page.
+func countRegisters(ctx context.Context, t *testing.T, rf *VBF3Redis) int {
+	t.Helper()
+	b, err := rf.c.Get(ctx, rf.key.data(0)).Bytes()
+	if err != nil {
+		t.Fatalf("failed to get data: %s", err)
+	}
+	n := 0
+	for _, v := range b {
+		if v != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSweep(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	for i := 0; i < 100; i++ {
+		err := rf.Put(ctx, []byte(strconv.Itoa(i)), uint8(i%2+1))
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	before := countRegisters(ctx, t, rf)
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	after := countRegisters(ctx, t, rf)
+	if after == 0 || after >= before {
+		t.Errorf("unexpected number of registers: before=%d after=%d", before, after)
+	}
+	for i := 1; i < 100; i += 2 {
+		has, err := rf.Check(ctx, []byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if !has {
+			t.Errorf("false negative for %d after sweep", i)
+		}
+	}
+	checkExists(ctx, t, c, 0, rf.key.sweep())
+
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	if n := countRegisters(ctx, t, rf); n != 0 {
+		t.Errorf("%d registers remain after all expired", n)
+	}
+}
+
+func TestSweepStepResume(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	for i := 0; i < 100; i++ {
+		err := rf.Put(ctx, []byte(strconv.Itoa(i)), 1)
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	steps := 0
+	for {
+		// other instances resume the sweep with the cursor in Redis.
+		rf2, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+		if err != nil {
+			t.Fatalf("failed to open: %s", err)
+		}
+		done, err := rf2.SweepStep(ctx, 1000)
+		if err != nil {
+			t.Fatalf("sweep step failed: %s", err)
+		}
+		steps++
+		if done {
+			break
+		}
+		if steps > 100 {
+			t.Fatal("sweep steps don't finish")
+		}
+	}
+	if steps != 10 {
+		t.Errorf("unexpected number of steps: want=10 got=%d", steps)
+	}
+	if n := countRegisters(ctx, t, rf); n != 0 {
+		t.Errorf("%d registers remain after sweep", n)
+	}
+	if _, err := rf.SweepStep(ctx, 0); err == nil {
+		t.Error("sweep step with zero size should fail")
+	}
+}
+
+func TestSweepResume(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	// extend the page to sweep whole registers.
+	err = c.BitField(ctx, rf.key.data(0), "SET", "u8", "#9999", 5).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	// interrupt a sweep at 3000.
+	for i := 0; i < 3; i++ {
+		_, err := rf.SweepStep(ctx, 1000)
+		if err != nil {
+			t.Fatalf("sweep step failed: %s", err)
+		}
+	}
+	// put expired registers before and after the cursor.
+	err = c.BitField(ctx, rf.key.data(0), "SET", "u8", "#10", 1, "SET", "u8", "#5000", 1).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	vals, err := c.BitField(ctx, rf.key.data(0), "GET", "u8", "#10", "GET", "u8", "#5000").Result()
+	if err != nil {
+		t.Fatalf("failed to get registers: %s", err)
+	}
+	// Sweep resumes from the cursor, so the register before it remains.
+	if vals[0] != 1 || vals[1] != 0 {
+		t.Errorf("unexpected registers after resumed sweep: %+v", vals)
+	}
+	checkExists(ctx, t, c, 0, rf.key.sweep())
+}
+
+func TestSweepInvalidCursor(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	for _, s := range []string{"", "0:5000", "1:0:1", "0:-1:1", "0:0:0", "0:0:256", "x:y:z"} {
+		err := c.Set(ctx, rf.key.sweep(), s, 0).Err()
+		if err != nil {
+			t.Fatalf("failed to setup: %s", err)
+		}
+		if _, err := rf.SweepStep(ctx, 1000); err == nil {
+			t.Errorf("sweep step should fail with cursor %q", s)
+		}
+	}
+}
+
+func TestSweepWithPut(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	for i := 0; i < 100; i++ {
+		err := rf.Put(ctx, []byte("old"+strconv.Itoa(i)), 1)
+		if err != nil {
+			t.Fatalf("put failed: %s", err)
+		}
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+
+	// sweep concurrently with writers, which never fails with conflicts.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			err := rf.Put(ctx, []byte("new"+strconv.Itoa(i)), 10)
+			if err != nil {
+				t.Errorf("put failed: %s", err)
+			}
+		}
+	}()
+	for {
+		done, err := rf.SweepStep(ctx, 100)
+		if err != nil {
+			t.Fatalf("sweep step failed: %s", err)
+		}
+		if done {
+			break
+		}
+	}
+	wg.Wait()
+	for i := 0; i < 100; i++ {
+		has, err := rf.Check(ctx, []byte("new"+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatalf("check failed: %s", err)
+		}
+		if !has {
+			t.Errorf("false negative for new%d", i)
+		}
+	}
+}
@@ -7,9 +7,11 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 
-	"github.com/dgryski/go-metro"
 	"github.com/go-redis/redis/v8"
+	"github.com/koron-go/bloomfilter"
 )
 
 const redisWatchRetryMax = 5
@@ -27,6 +29,16 @@ func watchWithRetry(ctx context.Context, uc redis.UniversalClient, fn func(tx *r
 
 type keyBase string
 
+// newKeyBase creates a keyBase for the filter. With hashTag, all keys are
+// hash-tagged by name like "{name}_gen", so they are in a same slot of Redis
+// Cluster.
+func newKeyBase(name string, hashTag bool) keyBase {
+	if hashTag {
+		return keyBase("{" + name + "}")
+	}
+	return keyBase(name)
+}
+
 func (kb keyBase) data(n int) string {
 	return string(kb) + "_" + strconv.Itoa(n)
 }
@@ -39,6 +51,14 @@ func (kb keyBase) gen() string {
 	return string(kb) + "_gen"
 }
 
+func (kb keyBase) sweep() string {
+	return string(kb) + "_sweep"
+}
+
+func (kb keyBase) lease() string {
+	return string(kb) + "_lease"
+}
+
 // VBF3Redis provides VBF3 with Redis backend.
 type VBF3Redis struct {
 	key keyBase
@@ -47,7 +67,11 @@ type VBF3Redis struct {
 
 	c redis.UniversalClient
 
+	ix bloomfilter.Indexer
+
 	pageNum int
+
+	autoSweep bool
 }
 
 // vbf3props codes constant properties of VBF3.
@@ -57,7 +81,36 @@ type vbf3props struct {
 
 	MaxLife uint8 `json:"max_life"`
 
-	SeedBase uint64 `json:"seed_base"` // for future use
+	// SeedBase is base of seeds for hash functions.
+	SeedBase uint64 `json:"seed_base"`
+
+	// Hash is name of the hash algorithm. Empty means "metro", which was
+	// used before this field was introduced.
+	Hash string `json:"hash,omitempty"`
+
+	// DoubleHashing is true when indexes are derived by double hashing.
+	DoubleHashing bool `json:"double_hashing,omitempty"`
+
+	// HashTag is true when keys are hash-tagged for Redis Cluster.
+	HashTag bool `json:"hash_tag,omitempty"`
+}
+
+// verify checks that properties match with existing one.
+func (p vbf3props) verify(got *vbf3props) error {
+	if p.SeedBase != got.SeedBase {
+		// don't reveal seeds, they may be secrets.
+		return errors.New("mismatch parameter: seed_base")
+	}
+	if p != *got {
+		return fmt.Errorf("mismatch parameter: want=%+v got=%+v", p.masked(), got.masked())
+	}
+	return nil
+}
+
+// masked returns a copy of properties without secrets, for messages.
+func (p vbf3props) masked() vbf3props {
+	p.SeedBase = 0
+	return p
 }
 
 func propsGet(ctx context.Context, c redis.Cmdable, key keyBase) (*vbf3props, bool, error) {
@@ -73,6 +126,9 @@ func propsGet(ctx context.Context, c redis.Cmdable, key keyBase) (*vbf3props, bo
 	if err != nil {
 		return nil, false, fmt.Errorf("invalid format of generation info: %w", err)
 	}
+	if v.Hash == "" {
+		v.Hash = bloomfilter.MetroHash{}.Name()
+	}
 	return v, true, nil
 }
 
@@ -92,6 +148,9 @@ func propsPut(ctx context.Context, c redis.Cmdable, key keyBase, p *vbf3props) e
 type vbf3gen struct {
 	Bottom uint8 `json:"bottom"`
 	Top    uint8 `json:"top"`
+	// Advanced is number of generations advanced since the last sweep.
+	// nil means unknown, for generation info created by older versions.
+	Advanced *int `json:"advanced,omitempty"`
 }
 
 func getGen(ctx context.Context, c redis.Cmdable, key keyBase) (*vbf3gen, error) {
@@ -133,22 +192,49 @@ func (g *vbf3gen) isValid(n uint8) bool {
 
 const pageSize = 512 * 1024 * 1024
 
+// pageCount returns number of page keys for m registers.
+func pageCount(m uint64) int {
+	return int(m/pageSize + 1)
+}
+
 // Open open a VBF3Redis instance when exists, otherwise create it.
 // When parameters are not match with existing one, this will fail.
-func Open(ctx context.Context, uc redis.UniversalClient, name string, m uint64, k uint, maxLife uint8) (*VBF3Redis, error) {
-	var key = keyBase(name)
+// It fails also when the filter exists with other key layout (see
+// WithHashTag).
+func Open(ctx context.Context, uc redis.UniversalClient, name string, m uint64, k uint, maxLife uint8, opts ...Option) (*VBF3Redis, error) {
+	o := newOptions(opts)
+	var key = newKeyBase(name, o.hashTag)
+	_, exists, err := propsGet(ctx, uc, newKeyBase(name, !o.hashTag))
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, fmt.Errorf("filter %q exists with other key layout: hash_tag=%t", name, !o.hashTag)
+	}
+	ix := bloomfilter.Indexer{
+		Hash:          o.hash,
+		Seed:          o.seed,
+		DoubleHashing: o.doubleHashing,
+	}
 	// FIXME: introduce transaction.
 	p, ok, err := propsGet(ctx, uc, key)
 	if err != nil {
 		return nil, err
 	}
 	props := vbf3props{
-		M:       m,
-		K:       k,
-		MaxLife: maxLife,
-	}
-	if ok && props != *p {
-		return nil, fmt.Errorf("mismatch parameter: want=%+v got=%+v", props, *p)
+		M:             m,
+		K:             k,
+		MaxLife:       maxLife,
+		SeedBase:      ix.Seed,
+		Hash:          ix.Name(),
+		DoubleHashing: ix.DoubleHashing,
+		HashTag:       o.hashTag,
+	}
+	if ok {
+		err := props.verify(p)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if !ok {
 		// create/setup a new VBF3 instance on Redis.
@@ -157,8 +243,9 @@ func Open(ctx context.Context, uc redis.UniversalClient, name string, m uint64,
 			return nil, err
 		}
 		err = putGen(ctx, uc, key, &vbf3gen{
-			Bottom: 1,
-			Top:    maxLife,
+			Bottom:   1,
+			Top:      maxLife,
+			Advanced: new(int),
 		})
 		if err != nil {
 			return nil, err
@@ -168,14 +255,12 @@ func Open(ctx context.Context, uc redis.UniversalClient, name string, m uint64,
 		key:       key,
 		vbf3props: props,
 		c:         uc,
-		pageNum:   int(m/pageSize + 1),
+		ix:        ix,
+		pageNum:   pageCount(m),
+		autoSweep: o.autoSweep,
 	}, nil
 }
 
-func (rf *VBF3Redis) hash(d []byte, n uint) int {
-	return int(metro.Hash64(d, uint64(n)) % rf.M)
-}
-
 type pos struct {
 	page  uint64
 	index uint64
@@ -206,9 +291,10 @@ func shrinkPos(pp []pos) []pos {
 
 func (rf *VBF3Redis) hashPos(dd ...[]byte) []pos {
 	pp := make([]pos, 0, int(rf.K)*len(dd))
+	var xx []uint64
 	for _, d := range dd {
-		for i := uint(0); i < rf.K; i++ {
-			x := metro.Hash64(d, uint64(i)) % rf.M
+		xx = rf.ix.Indexes(xx[:0], d, int(rf.K), rf.M)
+		for _, x := range xx {
 			pp = append(pp, pos{
 				page:  x / pageSize,
 				index: (x % pageSize) * 8,
@@ -221,9 +307,10 @@ func (rf *VBF3Redis) hashPos(dd ...[]byte) []pos {
 func (rf *VBF3Redis) hashArray(dd ...[]byte) []pos {
 	pp := make([]pos, 0, int(rf.K)*len(dd))
 	seen := map[uint64]struct{}{}
+	var xx []uint64
 	for _, d := range dd {
-		for i := uint(0); i < rf.K; i++ {
-			x := metro.Hash64(d, uint64(i)) % rf.M
+		xx = rf.ix.Indexes(xx[:0], d, int(rf.K), rf.M)
+		for _, x := range xx {
 			if _, ok := seen[x]; ok {
 				continue
 			}
@@ -240,63 +327,13 @@ func (rf *VBF3Redis) hashArray(dd ...[]byte) []pos {
 	return pp
 }
 
-// getValues gets current values by hashed `d` keys.
-func (rf *VBF3Redis) getValues(ctx context.Context, pp []pos) ([]*redis.IntSliceCmd, error) {
-	pages := make([]int, rf.pageNum)
-	args := make([]interface{}, 0, len(pp)*3)
-	for _, p := range pp {
-		pages[p.page]++
-		args = append(args, "GET", "u8", p.index)
-	}
-
-	cmds := make([]*redis.IntSliceCmd, 0, rf.pageNum)
-	_, err := rf.c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-		x := 0
-		for i, n := range pages {
-			if n == 0 {
-				continue
-			}
-			cmds = append(cmds, pipe.BitField(ctx, rf.key.data(i), args[x:x+n*3]...))
-			x += n * 3
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to check/get data: %w", err)
-	}
-	return cmds, nil
-}
-
-func (rf *VBF3Redis) setValues(ctx context.Context, pp []pos, pages []int, value uint8) error {
-	_, err := rf.c.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-		base := 0
-		for i, n := range pages {
-			if n == 0 {
-				continue
-			}
-			args := make([]interface{}, 0, n*4)
-			for j := 0; j < n; j++ {
-				args = append(args, "SET", "u8", pp[base+j].index, value)
-			}
-			base += n
-			pipe.BitField(ctx, rf.key.data(i), args...)
-		}
-		return nil
-	})
-	return err
-}
-
 // Put puts a value with life.
 func (rf *VBF3Redis) Put(ctx context.Context, d []byte, life uint8) error {
 	if life > rf.MaxLife {
 		return fmt.Errorf("life should be less than (<=) %d", rf.MaxLife)
 	}
-	gen, err := getGen(ctx, rf.c, rf.key)
-	if err != nil {
-		return err
-	}
 	pp := rf.hashArray(d)
-	return rf.put(ctx, gen, pp, life)
+	return rf.put(ctx, pp, life)
 }
 
 // PutAll puts all values with life
@@ -308,153 +345,80 @@ func (rf *VBF3Redis) PutAll(ctx context.Context, life uint8, dd [][]byte) error
 	if len(dd) == 0 {
 		return nil
 	}
-	gen, err := getGen(ctx, rf.c, rf.key)
-	if err != nil {
-		return err
-	}
 	pp := rf.hashArray(dd...)
-	return rf.put(ctx, gen, pp, life)
+	return rf.put(ctx, pp, life)
 }
 
-// put updates postions.
-func (rf *VBF3Redis) put(ctx context.Context, gen *vbf3gen, pp []pos, life uint8) error {
-	cmds, err := rf.getValues(ctx, pp)
-	if err != nil {
-		return err
-	}
-	// detect updates
-	updatePages := make([]int, rf.pageNum)
-	updates := make([]pos, 0, len(pp))
-	updateIndex := 0
-	for _, cmd := range cmds {
-		if cmd == nil {
-			continue
-		}
-		for _, v := range cmd.Val() {
-			v8 := uint8(v)
-			var curr uint8
-			if gen.isValid(v8) {
-				curr = v8 - gen.Bottom + 1
-				if v8 < gen.Bottom {
-					curr--
-				}
-			}
-			if curr == 0 || life > curr {
-				updatePages[pp[updateIndex].page]++
-				updates = append(updates, pp[updateIndex])
-			}
-			updateIndex++
-		}
-	}
-	if len(updates) == 0 {
-		return nil
-	}
-	// apply updates
-	nv := m255p1add(gen.Bottom, life-1)
-	err = rf.setValues(ctx, updates, updatePages, nv)
+// put updates postions atomically, by a script.
+func (rf *VBF3Redis) put(ctx context.Context, pp []pos, life uint8) error {
+	keys, args := rf.scriptArgs(pp, life)
+	err := scriptPut.Run(ctx, rf.c, keys, args...).Err()
 	if err != nil {
-		return fmt.Errorf("failed to set data for put: %w", err)
+		return fmt.Errorf("failed to put: %w", err)
 	}
 	return nil
 }
 
-type vbf3pair struct {
-	x int
-	v uint8
-}
-
-func (rf *VBF3Redis) Check(ctx context.Context, d []byte) (bool, error) {
-	gen, err := getGen(ctx, rf.c, rf.key)
-	if err != nil {
-		return false, err
+// CheckAndPut checks a value is available or not, and puts it with life
+// atomically. It returns true when the value was available before.
+func (rf *VBF3Redis) CheckAndPut(ctx context.Context, d []byte, life uint8) (bool, error) {
+	if life > rf.MaxLife {
+		return false, fmt.Errorf("life should be less than (<=) %d", rf.MaxLife)
 	}
 	pp := rf.hashArray(d)
-	cmds, err := rf.getValues(ctx, pp)
+	keys, args := rf.scriptArgs(pp, life)
+	r, err := scriptCheckAndPut.Run(ctx, rf.c, keys, args...).Int64()
 	if err != nil {
-		return false, err
+		return false, fmt.Errorf("failed to check and put: %w", err)
 	}
+	return r != 0, nil
+}
 
-	// detect invalids
-	validAll := true
-	invalidPages := make([]int, rf.pageNum)
-	invalids := make([]pos, 0, len(pp))
-	invalidIndex := 0
-	for _, cmd := range cmds {
-		if cmd == nil {
-			continue
-		}
-		for _, v := range cmd.Val() {
-			v8 := uint8(v)
-			if !gen.isValid(v8) {
-				validAll = false
-				if v8 != 0 {
-					invalidPages[pp[invalidIndex].page]++
-					invalids = append(invalids, pp[invalidIndex])
-				}
-			}
-			invalidIndex++
-		}
+// check checks positions atomically by a script, and returns validity of
+// each position. Invalid registers are cleared.
+func (rf *VBF3Redis) check(ctx context.Context, pp []pos) ([]bool, error) {
+	keys, args := rf.scriptArgs(pp)
+	vv, err := scriptCheck.Run(ctx, rf.c, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check: %w", err)
 	}
-	if validAll {
-		return true, nil
+	if len(vv) != len(pp) {
+		return nil, fmt.Errorf("unexpected length of check results: want=%d got=%d", len(pp), len(vv))
 	}
-	if len(invalids) == 0 {
-		return false, nil
+	results := make([]bool, len(vv))
+	for i, v := range vv {
+		results[i] = v != 0
 	}
+	return results, nil
+}
 
-	// clear invalids
-	err = rf.setValues(ctx, invalids, invalidPages, 0)
+func (rf *VBF3Redis) Check(ctx context.Context, d []byte) (bool, error) {
+	pp := rf.hashArray(d)
+	results, err := rf.check(ctx, pp)
 	if err != nil {
-		return false, fmt.Errorf("failed to clear invalids: %w", err)
+		return false, err
 	}
-	return false, nil
+	for _, r := range results {
+		if !r {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
 func (rf *VBF3Redis) CheckAll(ctx context.Context, dd [][]byte) ([]bool, error) {
 	if len(dd) == 0 {
 		return nil, nil
 	}
-	gen, err := getGen(ctx, rf.c, rf.key)
-	if err != nil {
-		return nil, err
-	}
 	rawpp := rf.hashPos(dd...)
 	pp0 := make([]pos, len(rawpp))
 	copy(pp0, rawpp)
 	pp := shrinkPos(pp0)
-	cmds, err := rf.getValues(ctx, pp)
+	results, err := rf.check(ctx, pp)
 	if err != nil {
 		return nil, err
 	}
 
-	results := make([]bool, len(pp))
-	invalidPages := make([]int, rf.pageNum)
-	invalids := make([]pos, 0, len(pp))
-	index := 0
-	for _, cmd := range cmds {
-		if cmd == nil {
-			continue
-		}
-		for _, v := range cmd.Val() {
-			v8 := uint8(v)
-			r := gen.isValid(v8)
-			results[index] = r
-			if !r && v8 != 0 {
-				invalidPages[pp[index].page]++
-				invalids = append(invalids, pp[index])
-			}
-			index++
-		}
-	}
-
-	// clear invalid registers.
-	if len(invalids) > 0 {
-		err := rf.setValues(ctx, invalids, invalidPages, 0)
-		if err != nil {
-			return nil, fmt.Errorf("failed to clear invalids: %w", err)
-		}
-	}
-
 	// compose return value
 	rv := make([]bool, len(dd))
 	for i := range dd {
@@ -473,14 +437,72 @@ func (rf *VBF3Redis) CheckAll(ctx context.Context, dd [][]byte) ([]bool, error)
 	return rv, nil
 }
 
+// AdvanceGeneration advances generation.
+// It returns bloomfilter.WraparoundError when advancing would resurrect
+// expired registers, which are not swept yet. Then call Sweep and retry, or
+// use WithAutoSweep option.
+// Generation info of old versions (or migrated from them) doesn't know
+// advanced generations since the last sweep, so it sweeps once before
+// advancing such a filter.
 func (rf *VBF3Redis) AdvanceGeneration(ctx context.Context, generations uint8) error {
-	return watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
+	swept := false
+	for g := int(generations); g > 0; {
+		n, err := rf.advance(ctx, g)
+		if err != nil {
+			var werr *bloomfilter.WraparoundError
+			if !errors.As(err, &werr) || rf.MaxLife == 255 {
+				return err
+			}
+			if werr.Advanced < 0 {
+				// the sweep should record advanced generations.
+				if swept {
+					return err
+				}
+			} else if !rf.autoSweep {
+				return err
+			}
+			swept = true
+			err := rf.Sweep(ctx)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		g -= n
+	}
+	return nil
+}
+
+// advance advances generation within the budget of wraparound, and returns
+// number of advanced generations. Without autoSweep, it advances all or
+// nothing.
+func (rf *VBF3Redis) advance(ctx context.Context, generations int) (int, error) {
+	var n int
+	err := watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
 		gen, err := getGen(tx.Context(), tx, rf.key)
 		if err != nil {
 			return err
 		}
-		gen.Bottom = m255p1add(gen.Bottom, generations)
-		gen.Top = m255p1add(gen.Top, generations)
+		advanced := -1
+		if gen.Advanced != nil {
+			advanced = *gen.Advanced
+		}
+		// expired registers come back after 256-MaxLife generations.
+		n = 255 - int(rf.MaxLife) - advanced
+		if advanced < 0 || n <= 0 || (!rf.autoSweep && n < generations) {
+			return &bloomfilter.WraparoundError{
+				MaxLife:     rf.MaxLife,
+				Advanced:    advanced,
+				Generations: generations,
+			}
+		}
+		if n > generations {
+			n = generations
+		}
+		gen.Bottom = m255p1add(gen.Bottom, uint8(n))
+		gen.Top = m255p1add(gen.Top, uint8(n))
+		advanced += n
+		gen.Advanced = &advanced
 		next, err := json.Marshal(gen)
 		if err != nil {
 			return err
@@ -491,47 +513,84 @@ func (rf *VBF3Redis) AdvanceGeneration(ctx context.Context, generations uint8) e
 		})
 		return err
 	}, rf.key.gen())
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
 }
 
+// sweepChunkSize is number of registers which are swept by a step of Sweep.
+const sweepChunkSize = 64 * 1024
+
+// Sweep clears all invalid registers, by repeating SweepStep until the end of
+// registers. It continues an interrupted sweep or a sweep by other processes
+// from the cursor in Redis, and starts from the head of registers when there
+// is no cursor. Each step blocks Redis only for a chunk, and it doesn't
+// conflict with concurrent Put and AdvanceGeneration.
 func (rf *VBF3Redis) Sweep(ctx context.Context) error {
-	//defer func(st time.Time) {
-	//	log.Printf("Sweep took %s", time.Since(st))
-	//}(time.Now())
-	gen, err := getGen(ctx, rf.c, rf.key)
-	if err != nil {
-		return err
-	}
-	for pn := 0; pn < rf.pageNum; pn++ {
-		keyData := rf.key.data(pn)
-		err := watchWithRetry(ctx, rf.c, func(tx *redis.Tx) error {
-			b, err := tx.Get(tx.Context(), keyData).Bytes()
-			if err != nil {
-				if errors.Is(err, redis.Nil) {
-					return nil
-				}
-				return err
-			}
-			var modified bool
-			for i, d := range b {
-				if d != 0 && !gen.isValid(d) {
-					b[i] = 0
-					modified = true
-				}
-			}
-			if !modified {
-				return nil
-			}
-			_, err = tx.Pipelined(tx.Context(), func(pipe redis.Pipeliner) error {
-				pipe.Set(tx.Context(), keyData, b, 0)
-				return nil
-			})
+	for {
+		if err := ctx.Err(); err != nil {
 			return err
-		}, keyData)
+		}
+		done, err := rf.SweepStep(ctx, sweepChunkSize)
 		if err != nil {
-			return fmt.Errorf("failed to sweep key:%q: %w", keyData, err)
+			return err
+		}
+		if done {
+			return nil
 		}
 	}
-	return nil
+}
+
+// sweepCursor is a position of incremental sweep.
+type sweepCursor struct {
+	page   int
+	offset int
+	// start is bottom generation when the sweep started, or -1 for a new
+	// sweep.
+	start int
+}
+
+func (rf *VBF3Redis) getSweepCursor(ctx context.Context) (sweepCursor, error) {
+	cur := sweepCursor{start: -1}
+	s, err := rf.c.Get(ctx, rf.key.sweep()).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return cur, nil
+		}
+		return cur, fmt.Errorf("failed to get sweep cursor with key %q: %w", rf.key.sweep(), err)
+	}
+	n, _ := fmt.Sscanf(s, "%d:%d:%d", &cur.page, &cur.offset, &cur.start)
+	if n != 3 || cur.page < 0 || cur.page >= rf.pageNum || cur.offset < 0 || cur.start < 1 || cur.start > 255 {
+		return cur, fmt.Errorf("invalid sweep cursor: %q", s)
+	}
+	return cur, nil
+}
+
+// SweepStep clears invalid registers in a chunk of size registers, from a
+// cursor which is stored in Redis, then advances the cursor.
+// It returns true when the cursor reaches the end of registers, and the
+// cursor is reset. So repeating SweepStep sweeps whole registers, and it can
+// be resumed by other processes.
+// When the sweep is done, the counter of advanced generations for
+// AdvanceGeneration is reset to generations advanced since the sweep started.
+func (rf *VBF3Redis) SweepStep(ctx context.Context, size int) (bool, error) {
+	if size <= 0 {
+		return false, fmt.Errorf("size should be positive: %d", size)
+	}
+	cur, err := rf.getSweepCursor(ctx)
+	if err != nil {
+		return false, err
+	}
+	keys := []string{rf.key.gen(), rf.key.data(cur.page), rf.key.sweep()}
+	r, err := scriptSweep.Run(ctx, rf.c, keys, cur.page, rf.pageNum, cur.offset, size, cur.start).Int64Slice()
+	if err != nil {
+		return false, fmt.Errorf("failed to sweep key:%q: %w", rf.key.data(cur.page), err)
+	}
+	if len(r) != 2 {
+		return false, fmt.Errorf("unexpected result of sweep: %+v", r)
+	}
+	return r[1] != 0, nil
 }
 
 func m255p1add(a, b uint8) uint8 {
@@ -548,25 +607,151 @@ func (rf *VBF3Redis) Drop(ctx context.Context) error {
 			pipe.Del(ctx, rf.key.data(i))
 		}
 		pipe.Del(ctx, rf.key.gen())
+		pipe.Del(ctx, rf.key.sweep())
+		pipe.Del(ctx, rf.key.lease())
 		pipe.Del(ctx, rf.key.props())
 		return nil
 	})
 	return err
 }
 
-func Drop(ctx context.Context, c redis.UniversalClient, name string) error {
-	keys, err := c.Keys(ctx, name+"_").Result()
-	if err != nil {
-		return fmt.Errorf("faild to list up keys: %w", err)
+// dropBatchSize is number of keys which are unlinked in a round-trip.
+const dropBatchSize = 100
+
+// Drop removes a filter with name in both key layouts, and returns number of
+// removed keys.
+// When properties of the filter are available, keys are computed from them.
+// Otherwise keys are searched by SCAN, so it doesn't block Redis.
+func Drop(ctx context.Context, c redis.UniversalClient, name string) (int, error) {
+	var removed int
+	for _, hashTag := range []bool{false, true} {
+		key := newKeyBase(name, hashTag)
+		p, ok, err := propsGet(ctx, c, key)
+		if err != nil {
+			return removed, err
+		}
+		var keys []string
+		if ok {
+			for i := 0; i < pageCount(p.M); i++ {
+				keys = append(keys, key.data(i))
+			}
+			keys = append(keys, key.gen(), key.sweep(), key.lease(), key.props())
+		} else {
+			keys, err = key.scan(ctx, c)
+			if err != nil {
+				return removed, err
+			}
+		}
+		n, err := unlinkKeys(ctx, c, keys)
+		removed += n
+		if err != nil {
+			return removed, fmt.Errorf("failed to drop keys of %q: %w", key, err)
+		}
 	}
-	if len(keys) == 0 {
-		return nil
+	return removed, nil
+}
+
+// globEscaper escapes special characters of glob-style patterns for SCAN.
+var globEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`*`, `\*`,
+	`?`, `\?`,
+	`[`, `\[`,
+	`]`, `\]`,
+)
+
+// owns checks that the key is one of keys of kb: props, gen, sweep, lease or
+// data pages.
+// It excludes keys of other filters which have kb as prefix of their names,
+// like "{kb}_foo_0".
+func (kb keyBase) owns(key string) bool {
+	if key == kb.props() || key == kb.gen() || key == kb.sweep() || key == kb.lease() {
+		return true
 	}
-	_, err = c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
-		for _, k := range keys {
-			pipe.Del(ctx, k)
+	prefix := string(kb) + "_"
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	suffix := key[len(prefix):]
+	if suffix == "" {
+		return false
+	}
+	for _, r := range suffix {
+		if r < '0' || r > '9' {
+			return false
 		}
-		return nil
-	})
-	return err
+	}
+	return true
+}
+
+// scan searches keys of kb with SCAN.
+// For Redis Cluster, it scans all master nodes.
+func (kb keyBase) scan(ctx context.Context, c redis.UniversalClient) ([]string, error) {
+	match := globEscaper.Replace(string(kb)) + "_*"
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	scan := func(ctx context.Context, c redis.Cmdable) error {
+		var cursor uint64
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			kk, next, err := c.Scan(ctx, cursor, match, dropBatchSize).Result()
+			if err != nil {
+				return fmt.Errorf("failed to scan keys of %q: %w", kb, err)
+			}
+			mu.Lock()
+			for _, k := range kk {
+				if kb.owns(k) {
+					keys = append(keys, k)
+				}
+			}
+			mu.Unlock()
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cc, ok := c.(*redis.ClusterClient); ok {
+		err := cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scan(ctx, c)
+		})
+		return keys, err
+	}
+	return keys, scan(ctx, c)
+}
+
+// unlinkKeys removes keys with UNLINK in batches, and returns number of
+// removed keys. Keys are unlinked one by one in a pipeline, because they may
+// be in different slots of Redis Cluster.
+func unlinkKeys(ctx context.Context, c redis.UniversalClient, keys []string) (int, error) {
+	var removed int
+	for len(keys) > 0 {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		n := dropBatchSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+		cmds, err := c.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for _, k := range keys[:n] {
+				pipe.Unlink(ctx, k)
+			}
+			return nil
+		})
+		for _, cmd := range cmds {
+			if ic, ok := cmd.(*redis.IntCmd); ok {
+				removed += int(ic.Val())
+			}
+		}
+		if err != nil {
+			return removed, err
+		}
+		keys = keys[n:]
+	}
+	return removed, nil
 }
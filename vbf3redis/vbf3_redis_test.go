@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/koron-go/bloomfilter"
 )
 
 func checkVBF3Redis(t *testing.T, m uint64, k uint, num int, f float64) {
@@ -196,7 +199,7 @@ func BenchmarkLargeVBF3RedisCheck(b *testing.B) {
 func BenchmarkVBF3RedisAdvanceGeneration(b *testing.B) {
 	c := newTestRedisClient(b)
 	ctx := context.Background()
-	rf, err := Open(ctx, c, b.Name(), 10*1000, 7, 10)
+	rf, err := Open(ctx, c, b.Name(), 10*1000, 7, 10, WithAutoSweep())
 	if err != nil {
 		b.Fatalf("failed to create: %s", err)
 	}
@@ -259,7 +262,7 @@ func testVBF3RedisTopBottom(ctx context.Context, t *testing.T, rf *VBF3Redis, bo
 func TestVBF3RedisAdvanceGeneration(t *testing.T) {
 	c := newTestRedisClient(t)
 	ctx := context.Background()
-	rf, err := Open(ctx, c, t.Name(), 256, 1, 1)
+	rf, err := Open(ctx, c, t.Name(), 256, 1, 1, WithAutoSweep())
 	if err != nil {
 		t.Fatalf("failed to create: %s", err)
 	}
@@ -339,3 +342,165 @@ func TestCheckAll(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenHash(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10, WithHash(bloomfilter.Murmur3{}))
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err == nil {
+		t.Error("open with default hash should fail")
+	}
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithHash(bloomfilter.XXHash{}))
+	if err == nil {
+		t.Error("open with other hash should fail")
+	}
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithHash(bloomfilter.Murmur3{}))
+	if err != nil {
+		t.Errorf("open with same hash failed: %s", err)
+	}
+}
+
+func TestOpenLegacyProps(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	key := keyBase(t.Name())
+	// properties which were written before "hash" was introduced.
+	err := c.Set(ctx, key.props(), `{"m":1000,"k":7,"max_life":10,"seed_base":0}`, 0).Err()
+	if err != nil {
+		t.Fatalf("failed to setup props: %s", err)
+	}
+	err = putGen(ctx, c, key, &vbf3gen{Bottom: 1, Top: 10})
+	if err != nil {
+		t.Fatalf("failed to setup gen: %s", err)
+	}
+	t.Cleanup(func() {
+		c.Del(ctx, key.props(), key.gen())
+	})
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err != nil {
+		t.Fatalf("open legacy props failed: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithHash(bloomfilter.FNV{}))
+	if err == nil {
+		t.Error("open legacy props with other hash should fail")
+	}
+}
+
+func TestOpenDoubleHashing(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10, WithDoubleHashing())
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10)
+	if err == nil {
+		t.Error("open without double hashing should fail")
+	}
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithDoubleHashing())
+	if err != nil {
+		t.Errorf("open with double hashing failed: %s", err)
+	}
+}
+
+func TestOpenSeed(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 1000, 7, 10, WithSeed(0xdeadbeef))
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	p, ok, err := propsGet(ctx, c, rf.key)
+	if err != nil || !ok {
+		t.Fatalf("failed to get props: ok=%t err=%v", ok, err)
+	}
+	if p.SeedBase != 0xdeadbeef {
+		t.Errorf("seed is not persisted: %+v", p)
+	}
+
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if !has {
+		t.Error("false negative")
+	}
+
+	for _, seed := range []uint64{0, 0xdeadbeee} {
+		_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithSeed(seed))
+		if err == nil {
+			t.Errorf("open with other seed %x should fail", seed)
+			continue
+		}
+		if strings.Contains(err.Error(), "deadbeef") || strings.Contains(err.Error(), "3735928559") {
+			t.Errorf("error reveals seed: %s", err)
+		}
+	}
+	_, err = Open(ctx, c, t.Name(), 1000, 7, 10, WithSeed(0xdeadbeef))
+	if err != nil {
+		t.Errorf("open with same seed failed: %s", err)
+	}
+}
+
+func TestSeedIndexes(t *testing.T) {
+	// filters with different seeds have different indexes.
+	rf0 := &VBF3Redis{vbf3props: vbf3props{M: 1 << 20, K: 7}}
+	rf1 := &VBF3Redis{
+		vbf3props: vbf3props{M: 1 << 20, K: 7},
+		ix:        bloomfilter.Indexer{Seed: 1},
+	}
+	d := []byte("foo")
+	p0, p1 := rf0.hashPos(d), rf1.hashPos(d)
+	same := 0
+	for i := range p0 {
+		if p0[i] == p1[i] {
+			same++
+		}
+	}
+	if same == len(p0) {
+		t.Errorf("seed is not used: %+v", p0)
+	}
+}
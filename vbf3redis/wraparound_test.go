@@ -0,0 +1,194 @@
+package vbf3redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/koron-go/bloomfilter"
+)
+
+// checkAdvanced checks "advanced" in the generation info.
+func checkAdvanced(ctx context.Context, t *testing.T, rf *VBF3Redis, want int) {
+	t.Helper()
+	gen, err := getGen(ctx, rf.c, rf.key)
+	if err != nil {
+		t.Fatalf("failed to get generation: %s", err)
+	}
+	if gen.Advanced == nil {
+		t.Fatalf("advanced is unknown: want=%d", want)
+	}
+	if *gen.Advanced != want {
+		t.Errorf("advanced mismatch: want=%d got=%d", want, *gen.Advanced)
+	}
+}
+
+func TestWraparound(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+
+	// 245 generations are safe, but 246th resurrects "foo".
+	err = rf.AdvanceGeneration(ctx, 245)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	checkAdvanced(ctx, t, rf, 245)
+	err = rf.AdvanceGeneration(ctx, 1)
+	var werr *bloomfilter.WraparoundError
+	if !errors.As(err, &werr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if werr.MaxLife != 10 || werr.Advanced != 245 || werr.Generations != 1 {
+		t.Errorf("unexpected error: %+v", werr)
+	}
+	testVBF3RedisTopBottom(ctx, t, rf, 246, 255)
+
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	checkAdvanced(ctx, t, rf, 0)
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance after sweep: %s", err)
+	}
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if has {
+		t.Error("foo is resurrected")
+	}
+}
+
+func TestWraparoundAutoSweep(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10, WithAutoSweep())
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 1)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 255)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	testVBF3RedisTopBottom(ctx, t, rf, 1, 10)
+	checkAdvanced(ctx, t, rf, 10)
+	has, err := rf.Check(ctx, []byte("foo"))
+	if err != nil {
+		t.Fatalf("check failed: %s", err)
+	}
+	if has {
+		t.Error("foo is resurrected")
+	}
+
+	// maxLife=255 can't be advanced even with auto sweep.
+	rf2, err := Open(ctx, c, t.Name()+"_255", 10000, 3, 255, WithAutoSweep())
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf2.Drop(ctx)
+	})
+	err = rf2.AdvanceGeneration(ctx, 1)
+	var werr *bloomfilter.WraparoundError
+	if !errors.As(err, &werr) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWraparoundSweepStep(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	err = rf.Put(ctx, []byte("foo"), 10)
+	if err != nil {
+		t.Fatalf("put failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 100)
+	if err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+	// generations advanced while sweeping are counted.
+	var n int
+	for ; ; n++ {
+		done, err := rf.SweepStep(ctx, 1000)
+		if err != nil {
+			t.Fatalf("sweep step failed: %s", err)
+		}
+		if done {
+			break
+		}
+		err = rf.AdvanceGeneration(ctx, 1)
+		if err != nil {
+			t.Fatalf("failed to advance: %s", err)
+		}
+	}
+	if n == 0 {
+		t.Fatal("sweep should take multiple steps")
+	}
+	checkAdvanced(ctx, t, rf, n)
+}
+
+func TestWraparoundLegacy(t *testing.T) {
+	ctx := context.Background()
+	c := newTestRedisClient(t)
+	rf, err := Open(ctx, c, t.Name(), 10000, 3, 10)
+	if err != nil {
+		t.Fatalf("failed to create: %s", err)
+	}
+	t.Cleanup(func() {
+		rf.Drop(ctx)
+	})
+	// generation info without "advanced", which was created by old version.
+	err = c.Set(ctx, rf.key.gen(), `{"bottom":1,"top":10}`, 0).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	// an expired register, which should be swept before advancing.
+	err = c.BitField(ctx, rf.key.data(0), "SET", "u8", "#100", 200).Err()
+	if err != nil {
+		t.Fatalf("failed to setup: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("advance failed: %s", err)
+	}
+	if n := countRegisters(ctx, t, rf); n != 0 {
+		t.Errorf("%d registers remain after advance", n)
+	}
+	checkAdvanced(ctx, t, rf, 1)
+	err = rf.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("sweep failed: %s", err)
+	}
+	err = rf.AdvanceGeneration(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to advance after sweep: %s", err)
+	}
+	checkAdvanced(ctx, t, rf, 1)
+}
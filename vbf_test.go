@@ -95,6 +95,39 @@ func TestVBFBasic3(t *testing.T) {
 	checkVBF(t, 1000, 7, 1000, 0.1, 3)
 }
 
+func TestVBFBasicOddBits(t *testing.T) {
+	// TTLs which require registers of 3, 5, 6 and 7 bits.
+	for _, ttl := range []uint8{7, 31, 63, 127} {
+		checkVBF(t, 1000, 7, 200, 0.1, ttl)
+		checkVBF(t, 1000, 7, 200, 0.5, ttl)
+		checkVBF(t, 1000, 7, 400, 0.1, ttl)
+	}
+}
+
+func TestVBFOddBitsData(t *testing.T) {
+	for nbits, ttl := range map[int]uint8{3: 7, 5: 31, 6: 63, 7: 127} {
+		vf, err := NewVBF(100, 8, ttl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if vf.nbits != nbits {
+			t.Errorf("unexpected vf.nbits: want=%d got=%d", nbits, vf.nbits)
+		}
+		if want := (nbits*100 + 7) / 8; len(vf.data) != want {
+			t.Errorf("unexpected len(vf.data): want=%d got=%d", want, len(vf.data))
+		}
+		for i := 0; i < 100; i++ {
+			vf.putData(i, uint8(i)%ttl)
+		}
+		for i := 0; i < 100; i++ {
+			if x, want := vf.getData(i), uint8(i)%ttl; x != want {
+				t.Errorf("data mismatch at %d: nbits=%d want=%02x got=%02x", i, nbits, want, x)
+				break
+			}
+		}
+	}
+}
+
 func TestVBFBasic15(t *testing.T) {
 	checkVBF(t, 1000, 7, 200, 0.1, 15)
 	checkVBF(t, 1000, 7, 200, 0.5, 15)